@@ -1,9 +1,12 @@
 package main
 
 import (
+	"aggressive-pokes/internal/capture"
 	"aggressive-pokes/internal/ltlogger"
+	"aggressive-pokes/internal/metrics"
 	"aggressive-pokes/internal/runnables"
 	"aggressive-pokes/internal/runner"
+	"flag"
 	"log/slog"
 	"net/http"
 	"os"
@@ -12,24 +15,83 @@ import (
 )
 
 func main() {
+	metricsAddr := flag.String("metrics", "", "address to expose /metrics for Prometheus on, e.g. :9100")
+	captureDir := flag.String("capture", "", "dir to save failed and sampled requests and responses into")
+	captureSample := flag.Float64("capture-sample", 1, "percentage of successful requests to capture")
+	caFile := flag.String("ca", "", "PEM bundle of CAs to trust on top of the system roots")
+	certFile := flag.String("cert", "", "PEM client certificate for mTLS")
+	keyFile := flag.String("key", "", "PEM key of the client certificate")
+	insecure := flag.Bool("insecure", false, "skip verification of the server certificate")
+	protocol := flag.String("protocol", "", "http1, http2 or h2c, https negotiates HTTP/2 or HTTP/1.1 by default")
+	conns := flag.Int("conns", 0, "max connections per host, 1000 by default")
+	streams := flag.Int("streams", 0, "max concurrent streams per HTTP/2 connection, 100 by default")
+	fail4xx := flag.Bool("fail4xx", false, "count 4xx responses as failures, 5xx responses always are")
+	flag.Parse()
+
 	logger := ltlogger.New(true, "LT Runner", slog.LevelDebug)
 	defer recoverLogPanic(logger)
 
+	lt := runner.NewLoadTest()
+	var httpOpts []runnables.HttpOption
+	if *captureDir != "" {
+		capturer, err := capture.New(logger, capture.Config{Dir: *captureDir, SampleRate: *captureSample / 100})
+		if err != nil {
+			logger.Fatal("Cannot capture requests", "err", err)
+		}
+		lt.AddCapture(capturer)
+		httpOpts = append(httpOpts, runnables.WithCapture(capturer))
+	}
+	client := runnables.HttpClientConfig{
+		Protocol:             *protocol,
+		MaxConnsPerHost:      *conns,
+		MaxConcurrentStreams: *streams,
+		TLS: runnables.TLSConfig{
+			CAFile:             *caFile,
+			CertFile:           *certFile,
+			KeyFile:            *keyFile,
+			InsecureSkipVerify: *insecure,
+		},
+	}
+	if err := client.Validate(); err != nil {
+		logger.Fatal("Invalid http client", "err", err)
+	}
+	httpOpts = append(httpOpts, runnables.WithClient(client))
+	if *fail4xx {
+		httpOpts = append(httpOpts, runnables.WithFail4xx())
+	}
+
 	hs := runnables.HttpRunnableWithSupplier(runnables.NewHttpRequestSupplier(
 		logger,
 		http.MethodPost,
 		"https://localhost:8081/api/search",
 		readPayload("internal/fixtures/lvrpl-lo.json"),
 		nil,
-		nil))
+		nil),
+		httpOpts...)
 
-	lt := runner.NewLoadTest()
-	lt.AddQpsStage(15, 10*time.Minute, hs)
+	lt.AddQpsStage(15, 10*time.Minute, hs, runner.WithWarmup(30*time.Second))
 	lt.AddQpsStage(22, 10*time.Minute, hs)
-	lt.AddQpsStage(30, 10*time.Minute, hs)
+	lt.AddQpsStage(30, 10*time.Minute, hs, runner.WithCooldown(10*time.Second))
+	lt.ExportResults("results")
+	if *metricsAddr != "" {
+		lt.AddSink(serveMetrics(logger, *metricsAddr))
+	}
+	go lt.ControlFrom(os.Stdin)
 	lt.Start()
 }
 
+func serveMetrics(logger ltlogger.Logger, addr string) *metrics.Registry {
+	registry := metrics.NewRegistry()
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", registry)
+	go func() {
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			logger.Error("Metrics server stopped", "err", err)
+		}
+	}()
+	return registry
+}
+
 func recoverLogPanic(logger ltlogger.Logger) {
 	if p := recover(); p != nil {
 		logger.Error("Panic!",
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"aggressive-pokes/internal/history"
+	"aggressive-pokes/internal/utils"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+const usage = `Usage:
+  history [-dir results] list
+  history [-dir results] baseline <run>
+  history [-dir results] [-latency 10] [-throughput 5] [-errors 1] diff [base] [current]
+
+Runs are referenced by id, unique id prefix, "latest" or "baseline".
+diff compares "latest" against "baseline" by default and exits with 1 on regression.`
+
+func main() {
+	dir := flag.String("dir", "results", "results directory runs were exported into")
+	latency := flag.Float64("latency", history.DefaultTolerance.LatencyPct, "allowed latency percentile increase, in percent")
+	throughput := flag.Float64("throughput", history.DefaultTolerance.ThroughputPct, "allowed throughput decrease, in percent")
+	errorRate := flag.Float64("errors", history.DefaultTolerance.ErrorRatePts, "allowed error rate increase, in percentage points")
+	flag.Usage = func() { fmt.Fprintln(os.Stderr, usage) }
+	flag.Parse()
+
+	store := history.NewStore(*dir)
+	args := flag.Args()
+	if len(args) == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	switch args[0] {
+	case "list":
+		list(store)
+	case "baseline":
+		if len(args) != 2 {
+			flag.Usage()
+			os.Exit(2)
+		}
+		id, err := store.SetBaseline(args[1])
+		exitOnErr(err)
+		utils.PrintBoxed("Baseline set", id)
+	case "diff":
+		base, current := "baseline", "latest"
+		if len(args) > 1 {
+			base = args[1]
+		}
+		if len(args) > 2 {
+			current = args[2]
+		}
+		tolerance := history.Tolerance{LatencyPct: *latency, ThroughputPct: *throughput, ErrorRatePts: *errorRate}
+		if !diff(store, base, current, tolerance) {
+			os.Exit(1)
+		}
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+}
+
+func list(store history.Store) {
+	entries, err := store.List()
+	exitOnErr(err)
+
+	lines := make([]string, 0, len(entries))
+	for _, e := range entries {
+		verdict := "passed"
+		if !e.Passed {
+			verdict = "FAILED"
+		}
+		lines = append(lines, fmt.Sprintf("%v | %-16v | %v | %-10v | stages: %v | %v",
+			e.ID, e.Scenario, e.StartTime.Format(time.DateTime), e.EndTime.Sub(e.StartTime).Round(time.Second), e.Stages, verdict))
+	}
+	if len(lines) == 0 {
+		lines = append(lines, "No runs stored")
+	}
+	utils.PrintBoxed("Runs", strings.Join(lines, "\n"))
+}
+
+func diff(store history.Store, baseID, currentID string, tolerance history.Tolerance) bool {
+	base, err := store.Load(baseID)
+	exitOnErr(err)
+	current, err := store.Load(currentID)
+	exitOnErr(err)
+
+	d := history.Compare(base, current, tolerance)
+	summary := "No regressions"
+	if n := d.Regressions(); n > 0 {
+		summary = fmt.Sprintf("%v regressions", n)
+	}
+	utils.PrintBoxed(fmt.Sprintf("Diff %v -> %v", base.ID, current.ID), d.Format(), summary)
+	return d.Regressions() == 0
+}
+
+func exitOnErr(err error) {
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"aggressive-pokes/internal/api"
+	"aggressive-pokes/internal/dashboard"
+	"aggressive-pokes/internal/ltlogger"
+	"aggressive-pokes/internal/scenario"
+	"flag"
+	"log/slog"
+	"os"
+)
+
+func main() {
+	addr := flag.String("addr", "127.0.0.1:8080", "dashboard and remote control API address")
+	scenarioPath := flag.String("scenario", "", "scenario file to start right away, otherwise submit one via the API")
+	resultsDir := flag.String("results", "results", "dir to export results of scenarios submitted via the API into, none if empty")
+	flag.Parse()
+
+	logger := ltlogger.New(true, "LT Dashboard", slog.LevelDebug)
+	controller := api.NewController(logger, *resultsDir)
+
+	if *scenarioPath != "" {
+		f, err := os.Open(*scenarioPath)
+		if err != nil {
+			logger.Fatal("Cannot open scenario", "path", *scenarioPath, "err", err)
+		}
+		s, err := scenario.Parse(f)
+		_ = f.Close()
+		if err != nil {
+			logger.Fatal("Cannot parse scenario", "path", *scenarioPath, "err", err)
+		}
+		if s.ResultsDir == "" {
+			s.ResultsDir = *resultsDir
+		}
+		lt, err := s.Build(logger)
+		if err != nil {
+			logger.Fatal("Cannot build scenario", "path", *scenarioPath, "err", err)
+		}
+		if err := controller.Submit(lt); err != nil {
+			logger.Fatal("Cannot submit scenario", "err", err)
+		}
+		if err := controller.Start(); err != nil {
+			logger.Fatal("Cannot start scenario", "err", err)
+		}
+	}
+
+	if err := dashboard.New(logger, controller).Start(*addr); err != nil {
+		logger.Fatal("Dashboard stopped", "err", err)
+	}
+}
@@ -70,7 +70,10 @@ func stubPubsubListener(logger ltlogger.Logger, projectId, topicName, subscripti
 		if err != nil {
 			logger.Fatal("Cannot create pubsub client", "err", err)
 		}
-		topic := utils.GetPubsubTopic(logger, pbClient, topicName)
+		topic, err := utils.GetPubsubTopic(logger, pbClient, topicName)
+		if err != nil {
+			logger.Fatal("Cannot get topic", "err", err)
+		}
 		subscription := utils.GetPubsubSubscription(logger, pbClient, topic, subscriptionName)
 
 		logger.Info("Listening for pubsub messages", "topic", topicName, "subscription", subscriptionName)
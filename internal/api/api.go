@@ -0,0 +1,207 @@
+package api
+
+import (
+	"aggressive-pokes/internal/ltlogger"
+	"aggressive-pokes/internal/metrics"
+	"aggressive-pokes/internal/runner"
+	"aggressive-pokes/internal/scenario"
+	"aggressive-pokes/internal/stats"
+	"errors"
+	"fmt"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+var (
+	errNoTest  = errors.New("no load test submitted")
+	errRunning = errors.New("load test is already running")
+	errStarted = errors.New("load test was already run, submit a new one")
+	// results of remote submissions go to the dir the server was configured with, clients can't touch other files
+	errLocalFiles = errors.New("can't be set remotely as they access files of the server, results are exported to its dir")
+)
+
+// Controller owns the load test driven remotely, one at a time.
+type Controller struct {
+	logger     ltlogger.Logger
+	resultsDir string
+	test       *runner.LoadTest
+	metrics    *metrics.Registry
+	started    bool
+	running    bool
+	mx         *sync.Mutex
+}
+
+// NewController exports results of scenarios submitted via the API into resultsDir, they aren't exported if it's empty.
+func NewController(logger ltlogger.Logger, resultsDir string) *Controller {
+	return &Controller{
+		logger:     logger,
+		resultsDir: resultsDir,
+		metrics:    metrics.NewRegistry(),
+		mx:         &sync.Mutex{},
+	}
+}
+
+// Test returns the latest submitted load test, nil if none was submitted yet.
+func (c *Controller) Test() *runner.LoadTest {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	return c.test
+}
+
+func (c *Controller) Running() bool {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	return c.running
+}
+
+// Submit replaces the previous load test unless it's still running.
+func (c *Controller) Submit(test *runner.LoadTest) error {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	if c.running {
+		return errRunning
+	}
+	test.AddSink(c.metrics)
+	c.test = test
+	c.started = false
+	return nil
+}
+
+// Start runs the submitted load test in background.
+func (c *Controller) Start() error {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	if c.test == nil {
+		return errNoTest
+	}
+	if c.running {
+		return errRunning
+	}
+	if c.started {
+		return errStarted
+	}
+	c.started, c.running = true, true
+	test := c.test
+	go func() {
+		c.logger.Info("Load test started", "id", test.ID())
+		test.Start()
+		c.logger.Info("Load test finished", "id", test.ID())
+
+		c.mx.Lock()
+		defer c.mx.Unlock()
+		c.running = false
+	}()
+	return nil
+}
+
+type qpsRequest struct {
+	Qps int `json:"qps" form:"qps"`
+}
+
+type statusResponse struct {
+	ID      string               `json:"id"`
+	Running bool                 `json:"running"`
+	Stages  []runner.StageStatus `json:"stages"`
+}
+
+// Register adds the remote control endpoints to e along with /metrics for Prometheus to scrape.
+func Register(e *echo.Echo, c *Controller) {
+	e.GET("/metrics", echo.WrapHandler(c.metrics))
+	g := e.Group("/api")
+	g.POST("/scenarios", c.submitScenario)
+	g.POST("/run/start", c.start)
+	g.POST("/run/stop", c.control((*runner.LoadTest).Stop))
+	g.POST("/run/pause", c.controlErr((*runner.LoadTest).Pause))
+	g.POST("/run/resume", c.controlErr((*runner.LoadTest).Resume))
+	g.PUT("/run/qps", c.setQps)
+	g.GET("/run/status", c.status)
+	g.GET("/run/result", c.result)
+}
+
+func (c *Controller) submitScenario(ctx echo.Context) error {
+	s, err := scenario.Parse(ctx.Request().Body)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if fields := s.LocalFiles(); len(fields) > 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("%v %v", strings.Join(fields, ", "), errLocalFiles))
+	}
+	s.ResultsDir = c.resultsDir
+	test, err := s.Build(c.logger)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if err := c.Submit(test); err != nil {
+		return echo.NewHTTPError(http.StatusConflict, err.Error())
+	}
+	return ctx.JSON(http.StatusCreated, map[string]string{"id": test.ID()})
+}
+
+func (c *Controller) start(ctx echo.Context) error {
+	if err := c.Start(); err != nil {
+		return echo.NewHTTPError(http.StatusConflict, err.Error())
+	}
+	return ctx.NoContent(http.StatusAccepted)
+}
+
+func (c *Controller) control(action func(*runner.LoadTest)) echo.HandlerFunc {
+	return c.controlErr(func(t *runner.LoadTest) error {
+		action(t)
+		return nil
+	})
+}
+
+func (c *Controller) controlErr(action func(*runner.LoadTest) error) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		test := c.Test()
+		if test == nil || !c.Running() {
+			return echo.NewHTTPError(http.StatusConflict, "no load test is running")
+		}
+		if err := action(test); err != nil {
+			return echo.NewHTTPError(http.StatusConflict, err.Error())
+		}
+		return ctx.NoContent(http.StatusNoContent)
+	}
+}
+
+func (c *Controller) setQps(ctx echo.Context) error {
+	var req qpsRequest
+	if err := ctx.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if req.Qps < 1 {
+		return echo.NewHTTPError(http.StatusBadRequest, "qps should be positive")
+	}
+	return c.controlErr(func(t *runner.LoadTest) error {
+		return t.SetQps(req.Qps)
+	})(ctx)
+}
+
+func (c *Controller) status(ctx echo.Context) error {
+	test := c.Test()
+	if test == nil {
+		return echo.NewHTTPError(http.StatusNotFound, errNoTest.Error())
+	}
+	return ctx.JSON(http.StatusOK, statusResponse{
+		ID:      test.ID(),
+		Running: c.Running(),
+		Stages:  test.Status(),
+	})
+}
+
+func (c *Controller) result(ctx echo.Context) error {
+	test := c.Test()
+	if test == nil {
+		return echo.NewHTTPError(http.StatusNotFound, errNoTest.Error())
+	}
+	// tags=endpoint=/search,reason=200 narrows the stats down to matching executions
+	filter, err := stats.ParseTags(ctx.QueryParam("tags"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	return ctx.JSON(http.StatusOK, test.FilteredResult(filter))
+}
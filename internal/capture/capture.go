@@ -0,0 +1,289 @@
+package capture
+
+import (
+	"aggressive-pokes/internal/ltlogger"
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	DefaultMaxBody     = 64 << 10
+	DefaultMaxFileSize = 10 << 20
+	DefaultMaxFiles    = 10
+	// recordBuffer bounds records waiting to be written, records beyond it are dropped rather than blocking
+	recordBuffer = 1024
+	redacted     = "[REDACTED]"
+)
+
+// DefaultRedact lists headers whose values are never written, on top of Config.Redact.
+var DefaultRedact = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "X-Api-Key"}
+
+type Config struct {
+	Dir string
+	// SampleRate is the share of successful requests captured on top of every failure, in range [0, 1]
+	SampleRate float64
+	// MaxBody truncates request and response bodies, DefaultMaxBody if not set
+	MaxBody int
+	// MaxFileSize starts a new file once exceeded, DefaultMaxFileSize if not set
+	MaxFileSize int64
+	// MaxFiles deletes the oldest files beyond it, DefaultMaxFiles if not set
+	MaxFiles int
+	// Redact lists additional headers whose values are replaced
+	Redact []string
+}
+
+// Record is a captured request along with its response, written as a single JSON line.
+type Record struct {
+	Time      time.Time `json:"time"`
+	Reason    string    `json:"reason"`
+	Failed    bool      `json:"failed"`
+	ElapsedUs int64     `json:"elapsed_us"`
+	Error     string    `json:"error,omitempty"`
+	Request   Message   `json:"request"`
+	Response  *Message  `json:"response,omitempty"`
+}
+
+type Message struct {
+	Method        string      `json:"method,omitempty"`
+	URL           string      `json:"url,omitempty"`
+	Status        int         `json:"status,omitempty"`
+	Headers       http.Header `json:"headers,omitempty"`
+	Body          string      `json:"body,omitempty"`
+	BodyTruncated bool        `json:"body_truncated,omitempty"`
+}
+
+// Capturer writes records into rotating JSONL files in background, dropping them when the disk can't keep up.
+type Capturer struct {
+	logger    ltlogger.Logger
+	config    Config
+	redact    map[string]bool
+	prefix    string
+	records   chan Record
+	dropped   atomic.Uint64
+	stop      chan struct{} // closed by Close, records never is as requests may still be finishing
+	closed    atomic.Bool
+	done      chan struct{}
+	closeOnce *sync.Once
+	files     []string // guarded by mx, written by the writer goroutine
+	sequence  int
+	mx        *sync.Mutex
+}
+
+func New(logger ltlogger.Logger, config Config) (*Capturer, error) {
+	if config.Dir == "" {
+		return nil, errors.New("capture requires a dir")
+	}
+	if config.SampleRate < 0 || config.SampleRate > 1 {
+		return nil, fmt.Errorf("sample rate [%v] should be in range [0, 1]", config.SampleRate)
+	}
+	if config.MaxBody <= 0 {
+		config.MaxBody = DefaultMaxBody
+	}
+	if config.MaxFileSize <= 0 {
+		config.MaxFileSize = DefaultMaxFileSize
+	}
+	if config.MaxFiles <= 0 {
+		config.MaxFiles = DefaultMaxFiles
+	}
+	if err := os.MkdirAll(config.Dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	redact := make(map[string]bool)
+	for _, h := range append(append([]string(nil), DefaultRedact...), config.Redact...) {
+		redact[http.CanonicalHeaderKey(h)] = true
+	}
+	c := &Capturer{
+		logger:    logger,
+		config:    config,
+		redact:    redact,
+		prefix:    time.Now().Format("20060102-150405"),
+		records:   make(chan Record, recordBuffer),
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+		closeOnce: &sync.Once{},
+		mx:        &sync.Mutex{},
+	}
+	go c.write()
+	return c, nil
+}
+
+// ShouldCapture tells whether to capture a request, failures always are while successes are sampled.
+func (c *Capturer) ShouldCapture(failed bool) bool {
+	return failed || c.config.SampleRate > 0 && rand.Float64() < c.config.SampleRate
+}
+
+// NewBody returns a writer keeping the first MaxBody bytes of a body.
+func (c *Capturer) NewBody() *Body {
+	return NewBody(c.config.MaxBody)
+}
+
+// Capture queues the record, redacting its headers right away.
+func (c *Capturer) Capture(r Record) {
+	if c.closed.Load() {
+		return
+	}
+	r.Request.Headers = c.redactHeaders(r.Request.Headers)
+	if r.Response != nil {
+		r.Response.Headers = c.redactHeaders(r.Response.Headers)
+	}
+	select {
+	case c.records <- r:
+	default:
+		c.dropped.Add(1)
+	}
+}
+
+func (c *Capturer) redactHeaders(h http.Header) http.Header {
+	if len(h) == 0 {
+		return nil
+	}
+	copied := make(http.Header, len(h))
+	for name, values := range h {
+		if c.redact[http.CanonicalHeaderKey(name)] {
+			copied[name] = []string{redacted}
+			continue
+		}
+		copied[name] = append([]string(nil), values...)
+	}
+	return copied
+}
+
+// Files lists capture files which weren't rotated away, oldest first.
+func (c *Capturer) Files() []string {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	return append([]string(nil), c.files...)
+}
+
+// Close writes pending records.
+func (c *Capturer) Close() {
+	c.closeOnce.Do(func() {
+		c.closed.Store(true)
+		close(c.stop)
+		<-c.done
+		if dropped := c.dropped.Load(); dropped > 0 {
+			c.logger.Warn("Capture couldn't keep up", "dir", c.config.Dir, "dropped", dropped)
+		}
+	})
+}
+
+func (c *Capturer) write() {
+	defer close(c.done)
+
+	var (
+		f       *os.File
+		w       *bufio.Writer
+		written int64
+	)
+	closeFile := func() {
+		if f == nil {
+			return
+		}
+		if err := w.Flush(); err != nil {
+			c.logger.Warn("Writing captures failed", "file", f.Name(), "err", err)
+		}
+		_ = f.Close()
+		f = nil
+	}
+	defer closeFile()
+
+	for {
+		var r Record
+		select {
+		case r = <-c.records:
+		case <-c.stop:
+			// writes records captured before the close, later ones are lost
+			select {
+			case r = <-c.records:
+			default:
+				return
+			}
+		}
+		line, err := json.Marshal(r)
+		if err != nil {
+			c.logger.Warn("Encoding capture failed", "err", err)
+			continue
+		}
+		if f == nil || written+int64(len(line)) > c.config.MaxFileSize && written > 0 {
+			closeFile()
+			if f, err = c.rotate(); err != nil {
+				c.logger.Warn("Creating capture file failed", "dir", c.config.Dir, "err", err)
+				c.dropped.Add(1)
+				continue
+			}
+			w, written = bufio.NewWriter(f), 0
+		}
+		n, _ := w.Write(append(line, '\n'))
+		written += int64(n)
+		// flushing once the queue is drained keeps files readable while the run goes on
+		if len(c.records) == 0 {
+			_ = w.Flush()
+		}
+	}
+}
+
+// rotate creates the next file and deletes the oldest ones beyond MaxFiles.
+func (c *Capturer) rotate() (*os.File, error) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	c.sequence++
+	path := filepath.Join(c.config.Dir, fmt.Sprintf("capture-%v-%04d.jsonl", c.prefix, c.sequence))
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	c.files = append(c.files, path)
+	for len(c.files) > c.config.MaxFiles {
+		if err := os.Remove(c.files[0]); err != nil {
+			c.logger.Warn("Deleting capture file failed", "file", c.files[0], "err", err)
+		}
+		c.files = c.files[1:]
+	}
+	return f, nil
+}
+
+// NewBody returns a writer keeping the first max bytes of a body.
+func NewBody(max int) *Body {
+	return &Body{max: max}
+}
+
+// Body keeps the beginning of a body written into it, discarding the rest.
+type Body struct {
+	buf       []byte
+	max       int
+	truncated bool
+}
+
+func (b *Body) Write(p []byte) (int, error) {
+	if room := b.max - len(b.buf); room < len(p) {
+		b.buf = append(b.buf, p[:max(room, 0)]...)
+		b.truncated = true
+	} else {
+		b.buf = append(b.buf, p...)
+	}
+	return len(p), nil
+}
+
+func (b *Body) String() string {
+	return string(b.buf)
+}
+
+// Bytes returns the kept beginning of the body, which the caller must not modify.
+func (b *Body) Bytes() []byte {
+	return b.buf
+}
+
+func (b *Body) Truncated() bool {
+	return b.truncated
+}
@@ -0,0 +1,163 @@
+package capture
+
+import (
+	"aggressive-pokes/internal/ltlogger"
+	"bufio"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newCapturer(t *testing.T, config Config) *Capturer {
+	config.Dir = t.TempDir()
+	c, err := New(ltlogger.New(false, "test", slog.LevelWarn), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(c.Close)
+	return c
+}
+
+// readRecords reads records of every file the capturer kept, oldest first.
+func readRecords(t *testing.T, c *Capturer) []Record {
+	var records []Record
+	for _, path := range c.Files() {
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			var r Record
+			if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+				t.Fatalf("%v: %v", path, err)
+			}
+			records = append(records, r)
+		}
+		_ = f.Close()
+	}
+	return records
+}
+
+func TestCaptureRotation(t *testing.T) {
+	c := newCapturer(t, Config{MaxFileSize: 300, MaxFiles: 2})
+	for i := 0; i < 20; i++ {
+		c.Capture(Record{Reason: "500", Request: Message{Method: http.MethodGet, URL: "http://localhost/" + strings.Repeat("x", 100)}})
+	}
+	c.Close()
+
+	files := c.Files()
+	if len(files) != 2 {
+		t.Fatalf("kept %v files, want 2", len(files))
+	}
+	entries, err := os.ReadDir(filepath.Dir(files[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Errorf("%v files left in the dir, want the oldest ones deleted", len(entries))
+	}
+	for _, path := range files {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Size() > 300 {
+			t.Errorf("%v has %v bytes, want at most 300", filepath.Base(path), info.Size())
+		}
+	}
+	if records := readRecords(t, c); len(records) == 0 || len(records) >= 20 {
+		t.Errorf("kept %v records, want the latest ones only", len(records))
+	}
+}
+
+func TestCaptureOversizedRecord(t *testing.T) {
+	c := newCapturer(t, Config{MaxFileSize: 10})
+	c.Capture(Record{Reason: "500"})
+	c.Capture(Record{Reason: "503"})
+	c.Close()
+
+	// a record larger than a file gets a file of its own rather than being dropped
+	if records := readRecords(t, c); len(records) != 2 || len(c.Files()) != 2 {
+		t.Errorf("kept %v records in %v files, want 2 in 2", len(records), len(c.Files()))
+	}
+}
+
+func TestCaptureAfterClose(t *testing.T) {
+	c := newCapturer(t, Config{})
+	c.Capture(Record{Reason: "500"})
+	c.Close()
+	c.Capture(Record{Reason: "503"})
+
+	if records := readRecords(t, c); len(records) != 1 || records[0].Reason != "500" {
+		t.Errorf("kept %+v, want the record captured before closing only", records)
+	}
+}
+
+func TestCaptureRedaction(t *testing.T) {
+	c := newCapturer(t, Config{Redact: []string{"x-session"}})
+	headers := http.Header{
+		"Authorization": {"Bearer secret"},
+		"X-Session":     {"secret"},
+		"Accept":        {"application/json"},
+	}
+	c.Capture(Record{
+		Reason:   "500",
+		Request:  Message{Method: http.MethodGet, URL: "http://localhost", Headers: headers},
+		Response: &Message{Status: 500, Headers: http.Header{"Set-Cookie": {"id=secret"}}},
+	})
+	c.Close()
+
+	records := readRecords(t, c)
+	if len(records) != 1 {
+		t.Fatalf("captured %v records, want 1", len(records))
+	}
+	r := records[0]
+	for _, name := range []string{"Authorization", "X-Session"} {
+		if got := r.Request.Headers.Get(name); got != redacted {
+			t.Errorf("request header %v = %q, want it redacted", name, got)
+		}
+	}
+	if got := r.Request.Headers.Get("Accept"); got != "application/json" {
+		t.Errorf("request header Accept = %q, want it kept", got)
+	}
+	if got := r.Response.Headers.Get("Set-Cookie"); got != redacted {
+		t.Errorf("response header Set-Cookie = %q, want it redacted", got)
+	}
+	if got := headers.Get("Authorization"); got != "Bearer secret" {
+		t.Errorf("headers of the caller were modified, Authorization = %q", got)
+	}
+}
+
+func TestBodyTruncation(t *testing.T) {
+	tests := []struct {
+		name      string
+		max       int
+		writes    []string
+		want      string
+		truncated bool
+	}{
+		{name: "fits", max: 10, writes: []string{"hello"}, want: "hello"},
+		{name: "exact fit", max: 5, writes: []string{"hel", "lo"}, want: "hello"},
+		{name: "truncated", max: 4, writes: []string{"hello"}, want: "hell", truncated: true},
+		{name: "truncated across writes", max: 7, writes: []string{"hello", "world", "!"}, want: "hellowo", truncated: true},
+		{name: "nothing kept", max: 0, writes: []string{"hello"}, want: "", truncated: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewBody(tt.max)
+			for _, w := range tt.writes {
+				if n, err := b.Write([]byte(w)); n != len(w) || err != nil {
+					t.Fatalf("Write(%q) = %v, %v, want the whole body consumed", w, n, err)
+				}
+			}
+			if b.String() != tt.want || b.Truncated() != tt.truncated {
+				t.Errorf("got %q truncated %v, want %q truncated %v", b.String(), b.Truncated(), tt.want, tt.truncated)
+			}
+		})
+	}
+}
@@ -0,0 +1,169 @@
+package dashboard
+
+import (
+	"aggressive-pokes/internal/api"
+	"aggressive-pokes/internal/ltlogger"
+	"aggressive-pokes/internal/results"
+	"aggressive-pokes/internal/runner"
+	"aggressive-pokes/internal/stats"
+	"embed"
+	"fmt"
+	"github.com/a-h/templ"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"time"
+)
+
+// rollingPeriod limits live charts to the most recent windows.
+const rollingPeriod = 2 * time.Minute
+
+// static holds the script driving the hx- attributes of the pages, served locally so the dashboard works offline.
+//
+//go:embed static
+var static embed.FS
+
+func micros(us int64) string {
+	return (time.Duration(us) * time.Microsecond).Round(10 * time.Microsecond).String()
+}
+
+func percent(v float64) string {
+	return fmt.Sprintf("%.1f%%", v*100)
+}
+
+func duration(d time.Duration) string {
+	return d.Round(time.Second).String()
+}
+
+func stateLabel(status runner.StageStatus) string {
+	if status.Paused {
+		return status.State + ", paused"
+	}
+	return status.State
+}
+
+func timeLabel(status runner.StageStatus) string {
+	label := "running for " + duration(status.Elapsed)
+	if status.State == "running" {
+		label += ", " + duration(status.Left) + " left"
+	}
+	return label
+}
+
+// Server serves a live view of the load test driven by the controller, refreshed by htmx polling.
+// Remote control endpoints are served alongside.
+type Server struct {
+	logger     ltlogger.Logger
+	controller *api.Controller
+	echo       *echo.Echo
+}
+
+type stageView struct {
+	Status runner.StageStatus
+	Result results.Stage
+}
+
+type stagesView struct {
+	ID         string
+	Filter     string // tags the stats are narrowed down to, e.g. endpoint=/search,reason=200
+	FilterErr  string
+	Running    bool
+	Stages     []stageView
+	Latency    templ.Component
+	Throughput templ.Component
+}
+
+func New(logger ltlogger.Logger, controller *api.Controller) *Server {
+	s := &Server{
+		logger:     logger,
+		controller: controller,
+		echo:       echo.New(),
+	}
+	s.echo.HideBanner = true
+	s.echo.GET("/", s.index)
+	s.echo.GET("/stages", s.stages)
+	s.echo.GET("/controls", s.controls)
+	s.echo.StaticFS("/static", echo.MustSubFS(static, "static"))
+	api.Register(s.echo, controller)
+	return s
+}
+
+func (s *Server) Start(addr string) error {
+	s.logger.Info("Dashboard started", "url", "http://"+addr)
+	return s.echo.Start(addr)
+}
+
+func (s *Server) index(c echo.Context) error {
+	return render(c, index(s.view(c.QueryParam("tags"))))
+}
+
+func (s *Server) stages(c echo.Context) error {
+	return render(c, stages(s.view(c.QueryParam("tags"))))
+}
+
+// controls are polled apart from stages, so the qps form next to them isn't re-rendered while typing.
+func (s *Server) controls(c echo.Context) error {
+	return render(c, runControls(s.controller.Test() != nil, s.controller.Running()))
+}
+
+func (s *Server) view(tags string) stagesView {
+	test := s.controller.Test()
+	if test == nil {
+		return stagesView{Filter: tags}
+	}
+	view := stagesView{ID: test.ID(), Running: s.controller.Running(), Filter: tags}
+	filter, err := stats.ParseTags(tags)
+	if err != nil {
+		view.FilterErr = err.Error()
+		filter = nil
+	}
+	run := test.FilteredResult(filter)
+	statuses := test.Status()
+
+	for i, stage := range run.Stages {
+		view.Stages = append(view.Stages, stageView{Status: statuses[i], Result: stage})
+	}
+	recent := rolling(run, time.Now().Add(-rollingPeriod))
+	view.Latency = results.LatencyChart(recent)
+	view.Throughput = results.ThroughputChart(recent)
+	return view
+}
+
+// rolling drops windows started before since, so live charts stay readable during long runs. Stages are clipped
+// to since as well, so their targets don't stretch the charts back.
+func rolling(run results.Run, since time.Time) results.Run {
+	trim := func(p *results.Phase) *results.Phase {
+		if p == nil {
+			return nil
+		}
+		trimmed := *p
+		trimmed.Windows = nil
+		for _, w := range p.Windows {
+			if !w.Start.Before(since) {
+				trimmed.Windows = append(trimmed.Windows, w)
+			}
+		}
+		return &trimmed
+	}
+
+	recent := run
+	recent.Stages = make([]results.Stage, len(run.Stages))
+	for i, s := range run.Stages {
+		switch {
+		case !s.EndTime.IsZero() && s.EndTime.Before(since):
+			s.StartTime = time.Time{}
+		case s.StartTime.Before(since) && !s.StartTime.IsZero():
+			s.StartTime = since
+		}
+		s.Stats = *trim(&s.Stats)
+		s.Warmup = trim(s.Warmup)
+		s.Cooldown = trim(s.Cooldown)
+		recent.Stages[i] = s
+	}
+	return recent
+}
+
+func render(c echo.Context, component templ.Component) error {
+	c.Response().Header().Set(echo.HeaderContentType, echo.MIMETextHTMLCharsetUTF8)
+	c.Response().WriteHeader(http.StatusOK)
+	return component.Render(c.Request().Context(), c.Response())
+}
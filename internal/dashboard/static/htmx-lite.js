@@ -0,0 +1,197 @@
+// A minimal subset of htmx (https://htmx.org), covering the attributes the dashboard pages use, so they work
+// without fetching scripts from a CDN:
+//   hx-get, hx-post, hx-put       issue the request, forms and hx-include add their fields as parameters
+//   hx-trigger                    comma separated, "every 1s", "submit" or "<event> [changed] [delay:500ms] [from:<selector>]"
+//   hx-target                     selector of the element to swap, the element itself by default
+//   hx-swap                       innerHTML or none
+//   hx-confirm                    asks before issuing the request
+// Responses swapped in are processed in turn. Requests of an element don't overlap, triggers firing meanwhile are dropped.
+(function () {
+	"use strict";
+
+	var methods = ["get", "post", "put"];
+
+	function parseInterval(s) {
+		var m = /^(\d+(?:\.\d+)?)(ms|s)?$/.exec(s);
+		if (!m) {
+			return 0;
+		}
+		return m[2] === "s" || m[2] === undefined ? parseFloat(m[1]) * 1000 : parseFloat(m[1]);
+	}
+
+	function defaultEvent(elt) {
+		if (elt.tagName === "FORM") {
+			return "submit";
+		}
+		if (elt.tagName === "INPUT" || elt.tagName === "SELECT" || elt.tagName === "TEXTAREA") {
+			return "change";
+		}
+		return "click";
+	}
+
+	function parseTriggers(elt) {
+		var spec = elt.getAttribute("hx-trigger") || defaultEvent(elt);
+		return spec.split(",").map(function (part) {
+			var tokens = part.trim().split(/\s+/);
+			if (tokens[0] === "every") {
+				return {every: parseInterval(tokens[1])};
+			}
+			var trigger = {event: tokens[0], changed: false, delay: 0, from: null};
+			tokens.slice(1).forEach(function (token) {
+				if (token === "changed") {
+					trigger.changed = true;
+				} else if (token.indexOf("delay:") === 0) {
+					trigger.delay = parseInterval(token.slice(6));
+				} else if (token.indexOf("from:") === 0) {
+					trigger.from = token.slice(5);
+				}
+			});
+			return trigger;
+		});
+	}
+
+	function verb(elt) {
+		for (var i = 0; i < methods.length; i++) {
+			var url = elt.getAttribute("hx-" + methods[i]);
+			if (url !== null) {
+				return {method: methods[i].toUpperCase(), url: url};
+			}
+		}
+		return null;
+	}
+
+	function params(elt, method) {
+		var data = new URLSearchParams();
+		var add = function (form) {
+			new FormData(form).forEach(function (value, name) {
+				data.append(name, value);
+			});
+		};
+		var form = elt.tagName === "FORM" ? elt : method !== "GET" ? elt.closest("form") : null;
+		if (form) {
+			add(form);
+		}
+		var include = elt.getAttribute("hx-include");
+		if (include) {
+			document.querySelectorAll(include).forEach(function (included) {
+				if (included.tagName === "FORM") {
+					add(included);
+				} else if (included.name) {
+					data.append(included.name, included.value);
+				}
+			});
+		}
+		return data;
+	}
+
+	function issue(elt) {
+		var request = verb(elt);
+		if (!request || elt.hxInFlight) {
+			return;
+		}
+		var question = elt.getAttribute("hx-confirm");
+		if (question && !window.confirm(question)) {
+			return;
+		}
+		var data = params(elt, request.method);
+		var url = request.url;
+		var init = {method: request.method, headers: {"HX-Request": "true"}};
+		if (request.method === "GET") {
+			var query = data.toString();
+			if (query) {
+				url += (url.indexOf("?") < 0 ? "?" : "&") + query;
+			}
+		} else {
+			init.body = data;
+		}
+		elt.hxInFlight = true;
+		fetch(url, init).then(function (res) {
+			return res.text().then(function (text) {
+				if (!res.ok) {
+					console.error("htmx-lite:", request.method, url, res.status, text);
+					return;
+				}
+				swap(elt, text);
+			});
+		}).catch(function (err) {
+			console.error("htmx-lite:", request.method, url, err);
+		}).finally(function () {
+			elt.hxInFlight = false;
+		});
+	}
+
+	function swap(elt, html) {
+		var style = elt.getAttribute("hx-swap") || "innerHTML";
+		if (style === "none") {
+			return;
+		}
+		var selector = elt.getAttribute("hx-target");
+		var target = selector ? document.querySelector(selector) : elt;
+		if (!target) {
+			return;
+		}
+		target.innerHTML = html;
+		process(target);
+	}
+
+	function bind(elt, trigger) {
+		if (trigger.every !== undefined) {
+			var timer = setInterval(function () {
+				if (!document.body.contains(elt)) {
+					clearInterval(timer);
+					return;
+				}
+				issue(elt);
+			}, trigger.every);
+			return;
+		}
+		var source = trigger.from ? document.querySelector(trigger.from) : elt;
+		if (!source) {
+			return;
+		}
+		var last = source.value;
+		var pending = null;
+		source.addEventListener(trigger.event, function (event) {
+			if (trigger.event === "submit") {
+				event.preventDefault();
+			}
+			if (trigger.changed) {
+				if (source.value === last) {
+					return;
+				}
+				last = source.value;
+			}
+			if (!trigger.delay) {
+				issue(elt);
+				return;
+			}
+			clearTimeout(pending);
+			pending = setTimeout(function () {
+				issue(elt);
+			}, trigger.delay);
+		});
+	}
+
+	function process(root) {
+		var selector = methods.map(function (m) {
+			return "[hx-" + m + "]";
+		}).join(",");
+		var elts = Array.prototype.slice.call(root.querySelectorAll(selector));
+		if (root.matches && root.matches(selector)) {
+			elts.unshift(root);
+		}
+		elts.forEach(function (elt) {
+			if (elt.hxProcessed) {
+				return;
+			}
+			elt.hxProcessed = true;
+			parseTriggers(elt).forEach(function (trigger) {
+				bind(elt, trigger);
+			});
+		});
+	}
+
+	document.addEventListener("DOMContentLoaded", function () {
+		process(document.body);
+	});
+})();
@@ -0,0 +1,171 @@
+package history
+
+import (
+	"aggressive-pokes/internal/results"
+	"fmt"
+	"strings"
+)
+
+// Tolerance tells how much worse a run may get before a change counts as a regression.
+type Tolerance struct {
+	// LatencyPct is the allowed relative latency increase, in percent
+	LatencyPct float64
+	// ThroughputPct is the allowed relative throughput decrease, in percent
+	ThroughputPct float64
+	// ErrorRatePts is the allowed error rate increase, in percentage points
+	ErrorRatePts float64
+}
+
+var DefaultTolerance = Tolerance{
+	LatencyPct:    10,
+	ThroughputPct: 5,
+	ErrorRatePts:  1,
+}
+
+type Diff struct {
+	Base    string
+	Current string
+	Stages  []StageDiff
+}
+
+type StageDiff struct {
+	ID      int
+	Missing bool // stage exists in one of the runs only
+	Changes []Change
+}
+
+// Change compares a single metric of a stage between two runs.
+type Change struct {
+	Metric     string
+	Base       float64
+	Current    float64
+	Delta      float64 // relative change in percent, percentage points for error rate
+	Regression bool
+}
+
+// Compare diffs stages of current against base stages with the same id.
+func Compare(base, current results.Run, tolerance Tolerance) Diff {
+	diff := Diff{Base: base.ID, Current: current.ID}
+
+	baseStages := make(map[int]results.Stage)
+	for _, s := range base.Stages {
+		baseStages[s.ID] = s
+	}
+	for _, s := range current.Stages {
+		b, ok := baseStages[s.ID]
+		if !ok {
+			diff.Stages = append(diff.Stages, StageDiff{ID: s.ID, Missing: true})
+			continue
+		}
+		delete(baseStages, s.ID)
+		diff.Stages = append(diff.Stages, compareStage(b, s, tolerance))
+	}
+	for _, s := range base.Stages {
+		if _, ok := baseStages[s.ID]; ok {
+			diff.Stages = append(diff.Stages, StageDiff{ID: s.ID, Missing: true})
+		}
+	}
+	return diff
+}
+
+func compareStage(base, current results.Stage, tolerance Tolerance) StageDiff {
+	diff := StageDiff{ID: current.ID}
+
+	basePercentiles := make(map[float64]int64)
+	for _, p := range base.Stats.Latency.Percentiles {
+		basePercentiles[p.Percentile] = p.ValueUs
+	}
+	for _, p := range current.Stats.Latency.Percentiles {
+		b, ok := basePercentiles[p.Percentile]
+		if !ok {
+			continue
+		}
+		delta := relativeDelta(float64(b), float64(p.ValueUs))
+		diff.Changes = append(diff.Changes, Change{
+			Metric:     fmt.Sprintf("p%v_us", p.Percentile),
+			Base:       float64(b),
+			Current:    float64(p.ValueUs),
+			Delta:      delta,
+			Regression: delta > tolerance.LatencyPct,
+		})
+	}
+
+	baseRate, currentRate := errorRate(base.Stats), errorRate(current.Stats)
+	diff.Changes = append(diff.Changes, Change{
+		Metric:     "error_rate_pct",
+		Base:       baseRate,
+		Current:    currentRate,
+		Delta:      currentRate - baseRate,
+		Regression: currentRate-baseRate > tolerance.ErrorRatePts,
+	})
+
+	delta := relativeDelta(base.Stats.Throughput, current.Stats.Throughput)
+	diff.Changes = append(diff.Changes, Change{
+		Metric:     "throughput",
+		Base:       base.Stats.Throughput,
+		Current:    current.Stats.Throughput,
+		Delta:      delta,
+		Regression: -delta > tolerance.ThroughputPct,
+	})
+	return diff
+}
+
+// Regressions counts changes which exceed the tolerance, and stages which exist in one of the runs only.
+func (d Diff) Regressions() int {
+	var n int
+	for _, s := range d.Stages {
+		if s.Missing {
+			n++
+		}
+		for _, c := range s.Changes {
+			if c.Regression {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+func (d Diff) Format() string {
+	var lines []string
+	for _, s := range d.Stages {
+		if s.Missing {
+			lines = append(lines, fmt.Sprintf("Stage [%v] exists in one of the runs only << REGRESSION", s.ID))
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("Stage [%v]", s.ID))
+		for _, c := range s.Changes {
+			marker := ""
+			if c.Regression {
+				marker = "<< REGRESSION"
+			}
+			lines = append(lines, fmt.Sprintf("  %-16v | base: %-12.6g | current: %-12.6g | delta: %+8.2f%v %v",
+				c.Metric, c.Base, c.Current, c.Delta, deltaUnit(c.Metric), marker))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func deltaUnit(metric string) string {
+	if metric == "error_rate_pct" {
+		return "pp"
+	}
+	return "%"
+}
+
+func errorRate(p results.Phase) float64 {
+	if p.Executed == 0 {
+		return 0
+	}
+	return float64(p.Errors) / float64(p.Executed) * 100
+}
+
+func relativeDelta(base, current float64) float64 {
+	if base == 0 {
+		if current == 0 {
+			return 0
+		}
+		return 100
+	}
+	return (current - base) / base * 100
+}
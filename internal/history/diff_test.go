@@ -0,0 +1,46 @@
+package history
+
+import (
+	"aggressive-pokes/internal/results"
+	"testing"
+)
+
+func stages(ids ...int) results.Run {
+	var run results.Run
+	for _, id := range ids {
+		run.Stages = append(run.Stages, results.Stage{ID: id, Stats: results.Phase{Executed: 100, Throughput: 10}})
+	}
+	return run
+}
+
+func TestCompareStages(t *testing.T) {
+	tests := []struct {
+		name        string
+		base        results.Run
+		current     results.Run
+		regressions int
+	}{
+		{name: "same stages", base: stages(1, 2), current: stages(1, 2), regressions: 0},
+		{name: "missing stage", base: stages(1, 2), current: stages(1), regressions: 1},
+		{name: "extra stage", base: stages(1), current: stages(1, 2), regressions: 1},
+		{name: "disjoint stages", base: stages(1), current: stages(2), regressions: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if n := Compare(tt.base, tt.current, DefaultTolerance).Regressions(); n != tt.regressions {
+				t.Errorf("got %v regressions, want %v", n, tt.regressions)
+			}
+		})
+	}
+}
+
+func TestCompareTolerance(t *testing.T) {
+	base, current := stages(1), stages(1)
+	current.Stages[0].Stats.Throughput = 9
+	if n := Compare(base, current, DefaultTolerance).Regressions(); n != 1 {
+		t.Errorf("got %v regressions for a 10%% throughput drop, want 1", n)
+	}
+	if n := Compare(base, current, Tolerance{ThroughputPct: 20}).Regressions(); n != 0 {
+		t.Errorf("got %v regressions within the tolerance, want 0", n)
+	}
+}
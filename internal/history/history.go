@@ -0,0 +1,150 @@
+package history
+
+import (
+	"aggressive-pokes/internal/results"
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	indexFile    = "index.jsonl"
+	baselineFile = "baseline"
+)
+
+// Store keeps every run exported into a results directory, indexed so past runs can be listed and compared.
+type Store struct {
+	dir string
+}
+
+// Entry is a line of the store index.
+type Entry struct {
+	ID        string    `json:"id"`
+	Scenario  string    `json:"scenario,omitempty"`
+	StartTime time.Time `json:"start_time"`
+	EndTime   time.Time `json:"end_time"`
+	Stages    int       `json:"stages"`
+	Passed    bool      `json:"passed"`
+}
+
+func NewStore(dir string) Store {
+	return Store{dir: dir}
+}
+
+// Save exports the run files and appends the run to the index, returning the written paths.
+func (s Store) Save(run results.Run) ([]string, error) {
+	paths, err := results.Export(s.dir, run)
+	if err != nil {
+		return paths, err
+	}
+
+	f, err := os.OpenFile(filepath.Join(s.dir, indexFile), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return paths, fmt.Errorf("open index: %w", err)
+	}
+	defer f.Close()
+
+	line, err := json.Marshal(Entry{
+		ID:        run.ID,
+		Scenario:  run.Scenario,
+		StartTime: run.StartTime,
+		EndTime:   run.EndTime,
+		Stages:    len(run.Stages),
+		Passed:    run.Passed(),
+	})
+	if err != nil {
+		return paths, err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return paths, fmt.Errorf("write index: %w", err)
+	}
+	return paths, nil
+}
+
+// List returns indexed runs, oldest first.
+func (s Store) List() ([]Entry, error) {
+	f, err := os.Open(filepath.Join(s.dir, indexFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("open index: %w", err)
+	}
+	defer f.Close()
+
+	var entries []Entry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("corrupted index line [%v]: %w", len(entries)+1, err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, scanner.Err()
+}
+
+// Load reads a stored run, the id may be shortened to a unique prefix or be "latest" or "baseline".
+func (s Store) Load(id string) (results.Run, error) {
+	resolved, err := s.resolve(id)
+	if err != nil {
+		return results.Run{}, err
+	}
+
+	f, err := os.Open(filepath.Join(s.dir, resolved+".json"))
+	if err != nil {
+		return results.Run{}, fmt.Errorf("open run [%v]: %w", resolved, err)
+	}
+	defer f.Close()
+	return results.ReadJSON(f)
+}
+
+// SetBaseline marks the run other runs are compared against by default.
+func (s Store) SetBaseline(id string) (string, error) {
+	resolved, err := s.resolve(id)
+	if err != nil {
+		return "", err
+	}
+	return resolved, os.WriteFile(filepath.Join(s.dir, baselineFile), []byte(resolved), 0o644)
+}
+
+func (s Store) resolve(id string) (string, error) {
+	if id == "baseline" {
+		b, err := os.ReadFile(filepath.Join(s.dir, baselineFile))
+		if err != nil {
+			return "", fmt.Errorf("no baseline set: %w", err)
+		}
+		return strings.TrimSpace(string(b)), nil
+	}
+
+	entries, err := s.List()
+	if err != nil {
+		return "", err
+	}
+	if len(entries) == 0 {
+		return "", errors.New("no runs stored")
+	}
+	if id == "latest" {
+		return entries[len(entries)-1].ID, nil
+	}
+
+	var matched []string
+	for _, e := range entries {
+		if strings.HasPrefix(e.ID, id) {
+			matched = append(matched, e.ID)
+		}
+	}
+	switch len(matched) {
+	case 0:
+		return "", fmt.Errorf("run [%v] not found", id)
+	case 1:
+		return matched[0], nil
+	default:
+		return "", fmt.Errorf("run id [%v] is ambiguous, matches %v runs", id, len(matched))
+	}
+}
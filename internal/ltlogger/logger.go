@@ -24,6 +24,6 @@ func New(structured bool, app string, level slog.Level) Logger {
 }
 
 func (l *Logger) Fatal(msg string, args ...any) {
-	l.Error(msg, args)
+	l.Error(msg, args...)
 	os.Exit(1)
 }
@@ -0,0 +1,304 @@
+package metrics
+
+import (
+	"aggressive-pokes/internal/stats"
+	"aggressive-pokes/internal/worker"
+	"bufio"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const contentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+
+// latencyBuckets are upper bounds of the request duration histogram, in seconds.
+var latencyBuckets = []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Registry accumulates live metrics of load tests and serves them in the OpenMetrics text format.
+// The lock only guards the series map, recording into an existing series is a handful of atomic adds.
+type Registry struct {
+	series map[seriesKey]*series
+	mx     *sync.RWMutex
+}
+
+type seriesKey struct {
+	scenario string
+	stage    int
+	reason   string
+	tags     string // rendered by stats.Tags.Key, so the key stays comparable
+}
+
+type series struct {
+	tags      stats.Tags
+	succeeded atomic.Uint64
+	failed    atomic.Uint64
+	buckets   []atomic.Uint64 // cumulative counts are computed on exposition
+	sumNanos  atomic.Int64
+	reused    atomic.Uint64
+	opened    atomic.Uint64
+	events    atomic.Uint64
+	sent      atomic.Uint64 // wire bytes
+	received  atomic.Uint64
+	phases    sync.Map // phase name to *phaseSeries
+}
+
+type phaseSeries struct {
+	count    atomic.Uint64
+	sumNanos atomic.Int64
+}
+
+func (s *series) phase(name string) *phaseSeries {
+	if p, ok := s.phases.Load(name); ok {
+		return p.(*phaseSeries)
+	}
+	p, _ := s.phases.LoadOrStore(name, &phaseSeries{})
+	return p.(*phaseSeries)
+}
+
+// phaseNames lists phases recorded so far, sorted.
+func (s *series) phaseNames() []string {
+	var names []string
+	s.phases.Range(func(name, _ any) bool {
+		names = append(names, name.(string))
+		return true
+	})
+	sort.Strings(names)
+	return names
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		series: make(map[seriesKey]*series),
+		mx:     &sync.RWMutex{},
+	}
+}
+
+// stageMetrics records executions of a single stage.
+type stageMetrics struct {
+	registry *Registry
+	scenario string
+	stage    int
+}
+
+// Stage returns the sink for executions of the given stage of a scenario.
+func (r *Registry) Stage(scenario string, stage int) stats.Sink {
+	return &stageMetrics{registry: r, scenario: scenario, stage: stage}
+}
+
+func (m *stageMetrics) Record(e stats.Execution) {
+	s := m.registry.get(seriesKey{scenario: m.scenario, stage: m.stage, reason: e.Reason, tags: e.TagsKey()}, e.Tags)
+	if e.Failed {
+		s.failed.Add(1)
+	} else {
+		s.succeeded.Add(1)
+	}
+	s.sumNanos.Add(int64(e.Elapsed))
+	if i := sort.SearchFloat64s(latencyBuckets, e.Elapsed.Seconds()); i < len(latencyBuckets) {
+		s.buckets[i].Add(1)
+	}
+	if e.Reused {
+		s.reused.Add(1)
+	}
+	if e.NewConnection {
+		s.opened.Add(1)
+	}
+	if e.Events != nil {
+		s.events.Add(uint64(e.Events.Count))
+	}
+	s.sent.Add(uint64(e.Sent.Wire()))
+	s.received.Add(uint64(e.Received.Wire()))
+	for _, p := range e.Phases {
+		ps := s.phase(p.Name)
+		ps.sumNanos.Add(int64(p.Elapsed))
+		ps.count.Add(1)
+	}
+}
+
+func (r *Registry) get(key seriesKey, tags stats.Tags) *series {
+	r.mx.RLock()
+	s, ok := r.series[key]
+	r.mx.RUnlock()
+	if ok {
+		return s
+	}
+
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	if s, ok := r.series[key]; ok {
+		return s
+	}
+	s = &series{tags: tags, buckets: make([]atomic.Uint64, len(latencyBuckets))}
+	r.series[key] = s
+	return s
+}
+
+func (r *Registry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", contentType)
+	bw := bufio.NewWriter(w)
+	r.write(bw)
+	_ = bw.Flush()
+}
+
+func (r *Registry) write(w *bufio.Writer) {
+	r.mx.RLock()
+	keys := make([]seriesKey, 0, len(r.series))
+	for k := range r.series {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.scenario != b.scenario {
+			return a.scenario < b.scenario
+		}
+		if a.stage != b.stage {
+			return a.stage < b.stage
+		}
+		if a.reason != b.reason {
+			return a.reason < b.reason
+		}
+		return a.tags < b.tags
+	})
+	snapshot := make([]*series, len(keys))
+	for i, k := range keys {
+		snapshot[i] = r.series[k]
+	}
+	r.mx.RUnlock()
+
+	fmt.Fprintln(w, "# TYPE pokes_requests counter")
+	fmt.Fprintln(w, "# HELP pokes_requests Executions reported by runnables.")
+	for i, k := range keys {
+		s := snapshot[i]
+		fmt.Fprintf(w, "pokes_requests_total%v %v\n", s.labels(k, "outcome", "success"), s.succeeded.Load())
+		fmt.Fprintf(w, "pokes_requests_total%v %v\n", s.labels(k, "outcome", "failure"), s.failed.Load())
+	}
+
+	fmt.Fprintln(w, "# TYPE pokes_request_duration_seconds histogram")
+	fmt.Fprintln(w, "# UNIT pokes_request_duration_seconds seconds")
+	fmt.Fprintln(w, "# HELP pokes_request_duration_seconds Latency reported by runnables.")
+	for i, k := range keys {
+		s := snapshot[i]
+		// counts are incremented before buckets and read after them, so +Inf never falls below the buckets
+		var cumulative uint64
+		for j, le := range latencyBuckets {
+			cumulative += s.buckets[j].Load()
+			fmt.Fprintf(w, "pokes_request_duration_seconds_bucket%v %v\n", s.labels(k, "le", formatFloat(le)), cumulative)
+		}
+		count := s.succeeded.Load() + s.failed.Load()
+		fmt.Fprintf(w, "pokes_request_duration_seconds_bucket%v %v\n", s.labels(k, "le", "+Inf"), count)
+		fmt.Fprintf(w, "pokes_request_duration_seconds_sum%v %v\n", s.labels(k), formatFloat(time.Duration(s.sumNanos.Load()).Seconds()))
+		fmt.Fprintf(w, "pokes_request_duration_seconds_count%v %v\n", s.labels(k), count)
+	}
+
+	fmt.Fprintln(w, "# TYPE pokes_request_phase_duration_seconds summary")
+	fmt.Fprintln(w, "# UNIT pokes_request_phase_duration_seconds seconds")
+	fmt.Fprintln(w, "# HELP pokes_request_phase_duration_seconds Latency of request phases, e.g. dns, connect, tls, ttfb and transfer.")
+	for i, k := range keys {
+		s := snapshot[i]
+		for _, name := range s.phaseNames() {
+			p := s.phase(name)
+			fmt.Fprintf(w, "pokes_request_phase_duration_seconds_sum%v %v\n", s.labels(k, "phase", name), formatFloat(time.Duration(p.sumNanos.Load()).Seconds()))
+			fmt.Fprintf(w, "pokes_request_phase_duration_seconds_count%v %v\n", s.labels(k, "phase", name), p.count.Load())
+		}
+	}
+
+	fmt.Fprintln(w, "# TYPE pokes_connections_reused counter")
+	fmt.Fprintln(w, "# HELP pokes_connections_reused Executions which reused a connection.")
+	for i, k := range keys {
+		fmt.Fprintf(w, "pokes_connections_reused_total%v %v\n", snapshot[i].labels(k), snapshot[i].reused.Load())
+	}
+
+	fmt.Fprintln(w, "# TYPE pokes_connections_opened counter")
+	fmt.Fprintln(w, "# HELP pokes_connections_opened Executions which opened a connection.")
+	for i, k := range keys {
+		fmt.Fprintf(w, "pokes_connections_opened_total%v %v\n", snapshot[i].labels(k), snapshot[i].opened.Load())
+	}
+
+	fmt.Fprintln(w, "# TYPE pokes_stream_events counter")
+	fmt.Fprintln(w, "# HELP pokes_stream_events Events of streamed responses, e.g. server-sent events.")
+	for i, k := range keys {
+		fmt.Fprintf(w, "pokes_stream_events_total%v %v\n", snapshot[i].labels(k), snapshot[i].events.Load())
+	}
+
+	fmt.Fprintln(w, "# TYPE pokes_sent_bytes counter")
+	fmt.Fprintln(w, "# UNIT pokes_sent_bytes bytes")
+	fmt.Fprintln(w, "# HELP pokes_sent_bytes Request headers and bodies as transferred.")
+	for i, k := range keys {
+		fmt.Fprintf(w, "pokes_sent_bytes_total%v %v\n", snapshot[i].labels(k), snapshot[i].sent.Load())
+	}
+	fmt.Fprintln(w, "# TYPE pokes_received_bytes counter")
+	fmt.Fprintln(w, "# UNIT pokes_received_bytes bytes")
+	fmt.Fprintln(w, "# HELP pokes_received_bytes Response headers and bodies as transferred.")
+	for i, k := range keys {
+		fmt.Fprintf(w, "pokes_received_bytes_total%v %v\n", snapshot[i].labels(k), snapshot[i].received.Load())
+	}
+
+	pool := worker.Stats()
+	fmt.Fprintln(w, "# TYPE pokes_worker_pool_size gauge")
+	fmt.Fprintln(w, "# HELP pokes_worker_pool_size Workers of the running stage.")
+	fmt.Fprintf(w, "pokes_worker_pool_size %v\n", pool.Size)
+	fmt.Fprintln(w, "# TYPE pokes_worker_pool_busy gauge")
+	fmt.Fprintln(w, "# HELP pokes_worker_pool_busy Workers currently executing a task.")
+	fmt.Fprintf(w, "pokes_worker_pool_busy %v\n", pool.Busy)
+	fmt.Fprintln(w, "# TYPE pokes_worker_pool_queued gauge")
+	fmt.Fprintln(w, "# HELP pokes_worker_pool_queued Tasks submitted but not picked up by a worker yet.")
+	fmt.Fprintf(w, "pokes_worker_pool_queued %v\n", pool.Queued)
+	fmt.Fprintln(w, "# TYPE pokes_scheduler_lag_seconds summary")
+	fmt.Fprintln(w, "# UNIT pokes_scheduler_lag_seconds seconds")
+	fmt.Fprintln(w, "# HELP pokes_scheduler_lag_seconds Time tasks waited for a free worker after being scheduled.")
+	fmt.Fprintf(w, "pokes_scheduler_lag_seconds_sum %v\n", formatFloat(pool.LagTotal.Seconds()))
+	fmt.Fprintf(w, "pokes_scheduler_lag_seconds_count %v\n", pool.LagCount)
+	fmt.Fprintln(w, "# TYPE pokes_scheduler_lag_max_seconds gauge")
+	fmt.Fprintln(w, "# UNIT pokes_scheduler_lag_max_seconds seconds")
+	fmt.Fprintln(w, "# HELP pokes_scheduler_lag_max_seconds Longest time a task waited for a free worker.")
+	fmt.Fprintf(w, "pokes_scheduler_lag_max_seconds %v\n", formatFloat(pool.LagMax.Seconds()))
+	fmt.Fprintln(w, "# EOF")
+}
+
+// labels renders the series labels and tags followed by extra name value pairs.
+func (s *series) labels(k seriesKey, extra ...string) string {
+	pairs := []string{
+		"scenario=" + quote(k.scenario),
+		fmt.Sprintf("stage=\"%v\"", k.stage),
+		"reason=" + quote(k.reason),
+	}
+	for _, name := range s.tags.Names() {
+		pairs = append(pairs, labelName(name)+"="+quote(s.tags[name]))
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, extra[i]+"="+quote(extra[i+1]))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// reservedLabels are set by the registry itself, tags of the same name are prefixed to keep series valid.
+var reservedLabels = map[string]bool{"scenario": true, "stage": true, "reason": true, "outcome": true, "le": true, "phase": true}
+
+// labelName turns a tag name into a valid label name, replacing invalid characters with underscores.
+func labelName(tag string) string {
+	name := []byte(tag)
+	for i, c := range name {
+		valid := c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || i > 0 && c >= '0' && c <= '9'
+		if !valid {
+			name[i] = '_'
+		}
+	}
+	if len(name) == 0 || reservedLabels[string(name)] || strings.HasPrefix(string(name), "__") {
+		return "tag_" + string(name)
+	}
+	return string(name)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func quote(v string) string {
+	return `"` + labelEscaper.Replace(v) + `"`
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
@@ -0,0 +1,99 @@
+package results
+
+import (
+	"fmt"
+	"github.com/a-h/templ"
+	"html"
+	"math"
+	"strings"
+)
+
+const (
+	chartWidth   = 960
+	chartHeight  = 280
+	chartPadding = 48
+)
+
+var chartColors = []string{"#2b6cb0", "#dd6b20", "#c53030", "#2f855a", "#6b46c1", "#b7791f", "#319795"}
+
+type point struct {
+	x, y float64
+}
+
+type series struct {
+	name   string
+	dashed bool
+	points []point
+}
+
+// marker is a labeled vertical line, e.g. a stage boundary.
+type marker struct {
+	x     float64
+	label string
+}
+
+// chart renders line series as an inline SVG, so reports stay self-contained.
+type chart struct {
+	title   string
+	unit    string
+	series  []series
+	markers []marker
+}
+
+func (c chart) SVG() templ.Component {
+	minX, maxX, maxY := math.Inf(1), 1.0, 1.0
+	for _, s := range c.series {
+		for _, p := range s.points {
+			minX = math.Min(minX, p.x)
+			maxX = math.Max(maxX, p.x)
+			maxY = math.Max(maxY, p.y)
+		}
+	}
+	if math.IsInf(minX, 1) || minX >= maxX {
+		minX = 0
+	}
+	maxY *= 1.1
+
+	plotW := float64(chartWidth - 2*chartPadding)
+	plotH := float64(chartHeight - 2*chartPadding)
+	scaleX := func(x float64) float64 { return chartPadding + (x-minX)/(maxX-minX)*plotW }
+	scaleY := func(y float64) float64 { return chartHeight - chartPadding - y/maxY*plotH }
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg viewBox="0 0 %d %d" class="chart" xmlns="http://www.w3.org/2000/svg">`, chartWidth, chartHeight)
+	fmt.Fprintf(&b, `<text x="%d" y="20" class="title">%v</text>`, chartPadding, html.EscapeString(c.title))
+
+	for i := 0; i <= 4; i++ {
+		y := maxY * float64(i) / 4
+		fmt.Fprintf(&b, `<line x1="%d" x2="%d" y1="%.1f" y2="%.1f" class="grid"/>`, chartPadding, chartWidth-chartPadding, scaleY(y), scaleY(y))
+		fmt.Fprintf(&b, `<text x="%d" y="%.1f" class="axis" text-anchor="end">%.4g%v</text>`, chartPadding-4, scaleY(y)+4, y, c.unit)
+	}
+	fmt.Fprintf(&b, `<text x="%d" y="%d" class="axis">%.0fs</text>`, chartPadding, chartHeight-chartPadding+16, minX)
+	fmt.Fprintf(&b, `<text x="%d" y="%d" class="axis" text-anchor="end">%.0fs</text>`, chartWidth-chartPadding, chartHeight-chartPadding+16, maxX)
+
+	for _, m := range c.markers {
+		if m.x < minX || m.x > maxX {
+			continue
+		}
+		x := scaleX(m.x)
+		fmt.Fprintf(&b, `<line x1="%.1f" x2="%.1f" y1="%d" y2="%d" class="marker"/>`, x, x, chartPadding, chartHeight-chartPadding)
+		fmt.Fprintf(&b, `<text x="%.1f" y="%d" class="axis">%v</text>`, x+3, chartPadding-4, html.EscapeString(m.label))
+	}
+
+	for i, s := range c.series {
+		color := chartColors[i%len(chartColors)]
+		var coords []string
+		for _, p := range s.points {
+			coords = append(coords, fmt.Sprintf("%.1f,%.1f", scaleX(p.x), scaleY(p.y)))
+		}
+		dash := ""
+		if s.dashed {
+			dash = ` stroke-dasharray="6 4"`
+		}
+		fmt.Fprintf(&b, `<polyline points="%v" fill="none" stroke="%v" stroke-width="1.5"%v/>`, strings.Join(coords, " "), color, dash)
+		fmt.Fprintf(&b, `<text x="%d" y="%d" class="legend" fill="%v">%v</text>`, chartPadding+i*120, chartHeight-12, color, html.EscapeString(s.name))
+	}
+
+	b.WriteString(`</svg>`)
+	return templ.Raw(b.String())
+}
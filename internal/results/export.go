@@ -0,0 +1,245 @@
+package results
+
+import (
+	"aggressive-pokes/internal/stats"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// csvHeader is the long format layout of exported CSV files, one metric value per row.
+// Phase totals have an empty window_start, metrics across all reasons have reason "*".
+// Tags of a reason are rendered sorted by name, e.g. "endpoint=/search,method=GET".
+var csvHeader = []string{"schema_version", "run_id", "stage", "phase", "window_start", "reason", "tags", "metric", "value"}
+
+// Export writes the run into dir as <run id>.json, <run id>.csv and an <run id>.html report, returning the written paths.
+func Export(dir string, run Run) ([]string, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create results dir: %w", err)
+	}
+
+	writers := []struct {
+		ext   string
+		write func(io.Writer, Run) error
+	}{
+		{".json", WriteJSON},
+		{".csv", WriteCSV},
+		{".html", WriteHTML},
+	}
+
+	var paths []string
+	for _, w := range writers {
+		path := filepath.Join(dir, run.ID+w.ext)
+		if err := writeFile(path, run, w.write); err != nil {
+			return paths, err
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
+
+func writeFile(path string, run Run, write func(io.Writer, Run) error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("create %v: %w", path, err)
+	}
+	if err := write(f, run); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("write %v: %w", path, err)
+	}
+	return f.Close()
+}
+
+func WriteJSON(w io.Writer, run Run) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(run)
+}
+
+// ReadJSON loads a run written by WriteJSON.
+func ReadJSON(r io.Reader) (Run, error) {
+	var run Run
+	if err := json.NewDecoder(r).Decode(&run); err != nil {
+		return Run{}, err
+	}
+	// older versions decode into a subset of the current layout
+	if run.SchemaVersion < 1 || run.SchemaVersion > SchemaVersion {
+		return Run{}, fmt.Errorf("unsupported schema version [%v], expected up to [%v]", run.SchemaVersion, SchemaVersion)
+	}
+	return run, nil
+}
+
+func WriteCSV(w io.Writer, run Run) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader); err != nil {
+		return err
+	}
+
+	for _, s := range run.Stages {
+		stage := strconv.Itoa(s.ID)
+		phases := []struct {
+			name  string
+			phase *Phase
+		}{
+			{"stats", &s.Stats},
+			{"warmup", s.Warmup},
+			{"cooldown", s.Cooldown},
+		}
+		for _, p := range phases {
+			if p.phase == nil {
+				continue
+			}
+			if err := writePhaseCSV(cw, run, stage, p.name, p.phase); err != nil {
+				return err
+			}
+		}
+		for _, v := range s.Verdicts {
+			if err := writeCSVRows(cw, run, stage, "verdict", "", v.Check, nil, map[string]float64{
+				"threshold": v.Threshold,
+				"actual":    v.Actual,
+				"passed":    boolValue(v.Passed),
+			}); err != nil {
+				return err
+			}
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+func writePhaseCSV(cw *csv.Writer, run Run, stage, phase string, p *Phase) error {
+	total := latencyMetrics(p.Latency)
+	total["count"] = float64(p.Executed)
+	total["errors"] = float64(p.Errors)
+	total["throughput"] = p.Throughput
+	addTransferMetrics(total, "sent", p.Sent)
+	addTransferMetrics(total, "received", p.Received)
+	if err := writeCSVRows(cw, run, stage, phase, "", "*", nil, total); err != nil {
+		return err
+	}
+	for _, r := range p.Reasons {
+		metrics := latencyMetrics(r.Latency)
+		metrics["count"] = float64(r.Count)
+		metrics["errors"] = float64(r.Errors)
+		if r.Reused+r.Opened > 0 {
+			metrics["reused"] = float64(r.Reused)
+			metrics["connections_opened"] = float64(r.Opened)
+		}
+		if r.StreamsMax > 0 {
+			metrics["streams_mean"] = r.StreamsMean
+			metrics["streams_max"] = float64(r.StreamsMax)
+		}
+		for _, rp := range r.Phases {
+			for name, v := range latencyMetrics(rp.Latency) {
+				metrics[rp.Name+"_"+name] = v
+			}
+		}
+		if r.Events != nil {
+			metrics["events_total"] = float64(r.Events.Total)
+			metrics["events_per_stream"] = r.Events.PerStream
+			metrics["events_max"] = float64(r.Events.Max)
+			for name, v := range latencyMetrics(r.Events.Gaps) {
+				metrics["event_gap_"+name] = v
+			}
+		}
+		addTransferMetrics(metrics, "sent", r.Sent)
+		addTransferMetrics(metrics, "received", r.Received)
+		if err := writeCSVRows(cw, run, stage, phase, "", r.Reason, r.Tags, metrics); err != nil {
+			return err
+		}
+	}
+	for _, w := range p.Windows {
+		start := w.Start.Format(time.RFC3339Nano)
+		metrics := latencyMetrics(w.Latency)
+		metrics["count"] = float64(w.Count)
+		metrics["errors"] = float64(w.Errors)
+		metrics["throughput"] = w.Throughput
+		if w.SentBytes > 0 || w.ReceivedBytes > 0 {
+			window := time.Duration(w.DurationMs) * time.Millisecond
+			metrics["sent_bytes_per_s"] = float64(w.SentBytes) / window.Seconds()
+			metrics["received_bytes_per_s"] = float64(w.ReceivedBytes) / window.Seconds()
+		}
+		if err := writeCSVRows(cw, run, stage, phase, start, "*", nil, metrics); err != nil {
+			return err
+		}
+		for _, r := range w.Reasons {
+			metrics := latencyMetrics(r.Latency)
+			metrics["count"] = float64(r.Count)
+			metrics["errors"] = float64(r.Errors)
+			if err := writeCSVRows(cw, run, stage, phase, start, r.Reason, r.Tags, metrics); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// writeCSVRows writes metrics in a stable, alphabetical order.
+func writeCSVRows(cw *csv.Writer, run Run, stage, phase, windowStart, reason string, tags stats.Tags, metrics map[string]float64) error {
+	names := make([]string, 0, len(metrics))
+	for name := range metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		row := []string{
+			strconv.Itoa(run.SchemaVersion),
+			run.ID,
+			stage,
+			phase,
+			windowStart,
+			reason,
+			tags.String(),
+			name,
+			strconv.FormatFloat(metrics[name], 'f', -1, 64),
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func latencyMetrics(l Latency) map[string]float64 {
+	metrics := map[string]float64{
+		"mean_us": float64(l.MeanUs),
+		"min_us":  float64(l.MinUs),
+		"max_us":  float64(l.MaxUs),
+	}
+	for _, p := range l.Percentiles {
+		metrics[fmt.Sprintf("p%v_us", p.Percentile)] = float64(p.ValueUs)
+	}
+	return metrics
+}
+
+// addTransferMetrics adds sizes prefixed by the direction, e.g. sent_wire_bytes, if the runnable measured them.
+func addTransferMetrics(metrics map[string]float64, direction string, t *Transfer) {
+	if t == nil {
+		return
+	}
+	metrics[direction+"_wire_bytes"] = float64(t.WireBytes)
+	metrics[direction+"_header_bytes"] = float64(t.HeaderBytes)
+	metrics[direction+"_body_bytes"] = float64(t.BodyBytes)
+	metrics[direction+"_decoded_bytes"] = float64(t.DecodedBytes)
+	metrics[direction+"_bytes_per_s"] = t.BytesPerSec
+	metrics[direction+"_size_mean_bytes"] = float64(t.Size.MeanBytes)
+	metrics[direction+"_size_max_bytes"] = float64(t.Size.MaxBytes)
+	for _, p := range t.Size.Percentiles {
+		metrics[fmt.Sprintf("%v_size_p%v_bytes", direction, p.Percentile)] = float64(p.ValueBytes)
+	}
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,205 @@
+package results
+
+import (
+	"aggressive-pokes/internal/stats"
+	"context"
+	"fmt"
+	"github.com/a-h/templ"
+	"io"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+func micros(us int64) string {
+	return (time.Duration(us) * time.Microsecond).Round(10 * time.Microsecond).String()
+}
+
+func rate(bytesPerSec float64) string {
+	return stats.FormatBytes(int64(bytesPerSec)) + "/s"
+}
+
+func transferBytes(t *Transfer) string {
+	if t == nil {
+		return stats.FormatBytes(0)
+	}
+	return stats.FormatBytes(t.WireBytes)
+}
+
+func transferRate(t *Transfer) string {
+	if t == nil {
+		return rate(0)
+	}
+	return rate(t.BytesPerSec)
+}
+
+// fileURL links local files, e.g. captures, from the report opened locally
+func fileURL(path string) templ.SafeURL {
+	return templ.SafeURL((&url.URL{Scheme: "file", Path: filepath.ToSlash(path)}).String())
+}
+
+func share(part, total int) string {
+	if total == 0 {
+		return "0%"
+	}
+	return fmt.Sprintf("%.2f%%", float64(part)/float64(total)*100)
+}
+
+func stageTitle(s Stage) string {
+	title := fmt.Sprintf("Stage %v: %v", s.ID, s.Config.Type)
+	if s.Config.Qps != 0 {
+		title += fmt.Sprintf(", %v qps", s.Config.Qps)
+	}
+	if s.Config.Amount != 0 {
+		title += fmt.Sprintf(", %v executions", s.Config.Amount)
+	}
+	return title
+}
+
+func phaseSummary(p Phase) string {
+	summary := fmt.Sprintf("Executed %v, errors %v (%v), throughput %.1f/s", p.Executed, p.Errors, share(p.Errors, p.Executed), p.Throughput)
+	if p.Sent != nil {
+		summary += fmt.Sprintf(", sent %v (%v)", stats.FormatBytes(p.Sent.WireBytes), rate(p.Sent.BytesPerSec))
+	}
+	if p.Received != nil {
+		summary += fmt.Sprintf(", received %v (%v)", stats.FormatBytes(p.Received.WireBytes), rate(p.Received.BytesPerSec))
+	}
+	return summary
+}
+
+func reasonLabel(r Reason) string {
+	if len(r.Tags) == 0 {
+		return r.Reason
+	}
+	return r.Reason + " " + r.Tags.String()
+}
+
+func sortedKeys(m map[string]int) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// targetTitle reads e.g. http target GET https://example.com.
+func targetTitle(t Target) string {
+	return strings.Join(strings.Fields(fmt.Sprintf("%v target %v %v", t.Type, t.Method, t.URL)), " ")
+}
+
+type reportView struct {
+	Run        Run
+	Passed     bool
+	Latency    templ.Component
+	Throughput templ.Component
+}
+
+// WriteHTML renders the run as a single self-contained HTML page with inline charts.
+func WriteHTML(w io.Writer, run Run) error {
+	return report(reportView{
+		Run:        run,
+		Passed:     run.Passed(),
+		Latency:    LatencyChart(run),
+		Throughput: ThroughputChart(run),
+	}).Render(context.Background(), w)
+}
+
+// LatencyChart renders window latency percentiles of the whole run as an inline SVG.
+func LatencyChart(run Run) templ.Component {
+	return latencyChart(run).SVG()
+}
+
+// ThroughputChart renders achieved window throughput against the target qps as an inline SVG.
+func ThroughputChart(run Run) templ.Component {
+	return throughputChart(run).SVG()
+}
+
+// timeline lists windows of every stage phase in run order, along with the stage boundaries and annotations.
+func timeline(run Run, each func(stage Stage, w Window, x float64)) []marker {
+	var markers []marker
+	for _, s := range run.Stages {
+		if s.StartTime.IsZero() {
+			continue
+		}
+		markers = append(markers, marker{x: s.StartTime.Sub(run.StartTime).Seconds(), label: fmt.Sprintf("Stage %v", s.ID)})
+		for _, phase := range []*Phase{s.Warmup, &s.Stats, s.Cooldown} {
+			if phase == nil {
+				continue
+			}
+			for _, w := range phase.Windows {
+				each(s, w, w.Start.Sub(run.StartTime).Seconds())
+			}
+			for _, a := range phase.Annotations {
+				markers = append(markers, marker{x: a.Time.Sub(run.StartTime).Seconds(), label: a.Message})
+			}
+		}
+	}
+	return markers
+}
+
+func latencyChart(run Run) chart {
+	var order []float64
+	byPercentile := make(map[float64]*series)
+	markers := timeline(run, func(_ Stage, w Window, x float64) {
+		for _, p := range w.Latency.Percentiles {
+			s, ok := byPercentile[p.Percentile]
+			if !ok {
+				s = &series{name: fmt.Sprintf("p%v", p.Percentile)}
+				byPercentile[p.Percentile] = s
+				order = append(order, p.Percentile)
+			}
+			s.points = append(s.points, point{x: x, y: float64(p.ValueUs) / 1000})
+		}
+	})
+
+	c := chart{title: "Latency percentiles", unit: "ms", markers: markers}
+	for _, p := range order {
+		c.series = append(c.series, *byPercentile[p])
+	}
+	return c
+}
+
+// stageEnd is the end of the last window of a stage which is still running, so it has no end yet.
+func stageEnd(s Stage) time.Time {
+	if !s.EndTime.IsZero() {
+		return s.EndTime
+	}
+	end := s.StartTime
+	for _, phase := range []*Phase{s.Warmup, &s.Stats, s.Cooldown} {
+		if phase == nil {
+			continue
+		}
+		for _, w := range phase.Windows {
+			if wEnd := w.Start.Add(time.Duration(w.DurationMs) * time.Millisecond); wEnd.After(end) {
+				end = wEnd
+			}
+		}
+	}
+	return end
+}
+
+func throughputChart(run Run) chart {
+	achieved := series{name: "achieved"}
+	target := series{name: "target", dashed: true}
+	markers := timeline(run, func(_ Stage, w Window, x float64) {
+		achieved.points = append(achieved.points, point{x: x, y: w.Throughput})
+	})
+	for _, s := range run.Stages {
+		if s.Config.Qps == 0 || s.StartTime.IsZero() {
+			continue
+		}
+		target.points = append(target.points,
+			point{x: s.StartTime.Sub(run.StartTime).Seconds(), y: float64(s.Config.Qps)},
+			point{x: stageEnd(s).Sub(run.StartTime).Seconds(), y: float64(s.Config.Qps)},
+		)
+	}
+
+	c := chart{title: "Throughput", unit: "/s", markers: markers, series: []series{achieved}}
+	if len(target.points) > 0 {
+		c.series = append(c.series, target)
+	}
+	return c
+}
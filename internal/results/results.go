@@ -0,0 +1,346 @@
+package results
+
+import (
+	"aggressive-pokes/internal/stats"
+	"sort"
+	"time"
+)
+
+// SchemaVersion is bumped on every incompatible change of the result layout,
+// so exported files can be post-processed reliably.
+// Version 2 splits reasons by tags and adds the tags column to CSV files.
+// Version 3 adds the scenario name and target of the run.
+const SchemaVersion = 3
+
+type Run struct {
+	SchemaVersion int       `json:"schema_version"`
+	ID            string    `json:"id"`
+	Scenario      string    `json:"scenario"`
+	Target        *Target   `json:"target,omitempty"`
+	StartTime     time.Time `json:"start_time"`
+	EndTime       time.Time `json:"end_time"`
+	Stages        []Stage   `json:"stages"`
+	// Captures are absolute paths of files with captured requests and responses of the run
+	Captures []string `json:"captures,omitempty"`
+}
+
+// Target is what a run pokes, Type being the kind of runnable, e.g. http or grpc.
+type Target struct {
+	Type   string `json:"type"`
+	URL    string `json:"url,omitempty"`
+	Method string `json:"method,omitempty"`
+}
+
+type Stage struct {
+	ID        int         `json:"id"`
+	Config    StageConfig `json:"config"`
+	StartTime time.Time   `json:"start_time"`
+	EndTime   time.Time   `json:"end_time"`
+	Stats     Phase       `json:"stats"`
+	Warmup    *Phase      `json:"warmup,omitempty"`
+	Cooldown  *Phase      `json:"cooldown,omitempty"`
+	Verdicts  []Verdict   `json:"verdicts"`
+}
+
+type StageConfig struct {
+	Type        string     `json:"type"`
+	Qps         int        `json:"qps,omitempty"`
+	DurationMs  int64      `json:"duration_ms,omitempty"`
+	Amount      int        `json:"amount,omitempty"`
+	AsyncFactor int        `json:"async_factor,omitempty"`
+	WarmupMs    int64      `json:"warmup_ms,omitempty"`
+	CooldownMs  int64      `json:"cooldown_ms,omitempty"`
+	WindowMs    int64      `json:"window_ms"`
+	Percentiles []float64  `json:"percentiles"`
+	Tags        stats.Tags `json:"tags,omitempty"`
+	// Filter narrows the stats down to executions having these tags, empty for complete stats
+	Filter stats.Tags `json:"filter,omitempty"`
+}
+
+type Phase struct {
+	Executed    int          `json:"executed"`
+	Errors      int          `json:"errors"`
+	Throughput  float64      `json:"throughput"`
+	Latency     Latency      `json:"latency"`
+	Sent        *Transfer    `json:"sent,omitempty"`
+	Received    *Transfer    `json:"received,omitempty"`
+	Reasons     []Reason     `json:"reasons"`
+	Windows     []Window     `json:"windows"`
+	Annotations []Annotation `json:"annotations,omitempty"`
+}
+
+// Annotation marks a moment of the stage, e.g. a manual pause or qps adjustment.
+type Annotation struct {
+	Time    time.Time `json:"time"`
+	Message string    `json:"message"`
+}
+
+// Reason holds metrics of executions sharing the reason and tags.
+type Reason struct {
+	Reason  string        `json:"reason"`
+	Tags    stats.Tags    `json:"tags,omitempty"`
+	Count   int           `json:"count"`
+	Errors  int           `json:"errors"`
+	Latency Latency       `json:"latency"`
+	Samples []ErrorSample `json:"error_samples,omitempty"`
+	// OtherErrors counts failures whose message didn't fit the bounded samples
+	OtherErrors int `json:"other_errors,omitempty"`
+	// Phases break latency down, e.g. dns, connect, tls, ttfb and transfer of HTTP requests
+	Phases []RequestPhase `json:"phases,omitempty"`
+	Reused int            `json:"reused,omitempty"` // executions which reused a connection
+	// Protocols count executions per negotiated protocol, e.g. "HTTP/1.1 TLS 1.3 TLS_AES_128_GCM_SHA256"
+	Protocols map[string]int `json:"protocols,omitempty"`
+	Opened    int            `json:"connections_opened,omitempty"`
+	// StreamsMean and StreamsMax tell how many streams shared a connection, present for multiplexed protocols
+	StreamsMean float64 `json:"streams_per_connection_mean,omitempty"`
+	StreamsMax  int     `json:"streams_per_connection_max,omitempty"`
+	// Events are present when the runnable streams responses
+	Events *Events `json:"events,omitempty"`
+	// Sent and Received are present when the runnable measures sizes
+	Sent     *Transfer `json:"sent,omitempty"`
+	Received *Transfer `json:"received,omitempty"`
+}
+
+// Transfer holds sizes of requests or responses, wire bytes are headers and body as transferred.
+type Transfer struct {
+	WireBytes    int64   `json:"wire_bytes"`
+	HeaderBytes  int64   `json:"header_bytes"`
+	BodyBytes    int64   `json:"body_bytes"`
+	DecodedBytes int64   `json:"decoded_bytes"` // body after decompression
+	BytesPerSec  float64 `json:"bytes_per_s"`
+	Size         Size    `json:"size"` // wire size of a single execution
+}
+
+type Size struct {
+	MeanBytes   int64            `json:"mean_bytes"`
+	MaxBytes    int64            `json:"max_bytes"`
+	Percentiles []SizePercentile `json:"percentiles"`
+}
+
+type SizePercentile struct {
+	Percentile float64 `json:"p"`
+	ValueBytes int64   `json:"value_bytes"`
+}
+
+// Events describe streamed responses, gaps are times between consecutive events.
+type Events struct {
+	Streams   int     `json:"streams"`
+	Total     int     `json:"total"`
+	PerStream float64 `json:"per_stream"`
+	Max       int     `json:"max"`
+	Gaps      Latency `json:"gaps"`
+}
+
+func newEvents(s *stats.EventStats, percentiles []float64) *Events {
+	if s == nil {
+		return nil
+	}
+	return &Events{Streams: s.Streams, Total: s.Count, PerStream: s.PerStream(), Max: s.Max, Gaps: NewLatency(s.Gaps, percentiles)}
+}
+
+type RequestPhase struct {
+	Name    string  `json:"name"`
+	Latency Latency `json:"latency"`
+}
+
+type ErrorSample struct {
+	Message   string    `json:"message"`
+	Count     int       `json:"count"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+type Latency struct {
+	MeanUs      int64        `json:"mean_us"`
+	MinUs       int64        `json:"min_us"`
+	MaxUs       int64        `json:"max_us"`
+	Percentiles []Percentile `json:"percentiles"`
+}
+
+type Percentile struct {
+	Percentile float64 `json:"p"`
+	ValueUs    int64   `json:"value_us"`
+}
+
+type Window struct {
+	Start      time.Time `json:"start"`
+	DurationMs int64     `json:"duration_ms"`
+	Count      int       `json:"count"`
+	Errors     int       `json:"errors"`
+	Throughput float64   `json:"throughput"`
+	Latency    Latency   `json:"latency"`
+	// SentBytes and ReceivedBytes are wire bytes, divide by the duration for bandwidth
+	SentBytes     int64          `json:"sent_bytes,omitempty"`
+	ReceivedBytes int64          `json:"received_bytes,omitempty"`
+	Reasons       []WindowReason `json:"reasons"`
+}
+
+type WindowReason struct {
+	Reason  string     `json:"reason"`
+	Tags    stats.Tags `json:"tags,omitempty"`
+	Count   int        `json:"count"`
+	Errors  int        `json:"errors"`
+	Latency Latency    `json:"latency"`
+}
+
+type Verdict struct {
+	Check     string  `json:"check"`
+	Threshold float64 `json:"threshold"`
+	Actual    float64 `json:"actual"`
+	Passed    bool    `json:"passed"`
+}
+
+// Passed tells whether every verdict of every stage passed.
+func (r Run) Passed() bool {
+	for _, s := range r.Stages {
+		for _, v := range s.Verdicts {
+			if !v.Passed {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// NewPhase converts a stats snapshot, resolving the given latency percentiles.
+// Throughput is calculated against the given phase duration.
+func NewPhase(snapshot stats.Snapshot, duration time.Duration, percentiles []float64) Phase {
+	phase := Phase{
+		Executed: snapshot.Executed,
+		Errors:   snapshot.Errors,
+		Latency:  NewLatency(snapshot.Latency(), percentiles),
+		Reasons:  make([]Reason, 0, len(snapshot.Series)),
+		Windows:  make([]Window, 0, len(snapshot.Windows)),
+	}
+	if duration > 0 {
+		phase.Throughput = float64(snapshot.Executed) / duration.Seconds()
+	}
+	sent, received := snapshot.Transfer()
+	phase.Sent = newTransfer(sent, duration, percentiles)
+	phase.Received = newTransfer(received, duration, percentiles)
+	for _, r := range snapshot.Series {
+		phase.Reasons = append(phase.Reasons, Reason{
+			Reason:      r.Reason,
+			Tags:        r.Tags,
+			Count:       r.Count,
+			Errors:      r.Errors,
+			Latency:     NewLatency(r.Latency, percentiles),
+			Samples:     newErrorSamples(r.Samples),
+			OtherErrors: r.OtherErrors,
+			Phases:      newRequestPhases(r.Phases, percentiles),
+			Reused:      r.Reused,
+			Protocols:   r.Protocols,
+			Opened:      r.Opened,
+			StreamsMean: r.Streams.Mean(),
+			StreamsMax:  r.Streams.Max,
+			Events:      newEvents(r.Events, percentiles),
+			Sent:        newTransfer(r.Sent, duration, percentiles),
+			Received:    newTransfer(r.Received, duration, percentiles),
+		})
+	}
+	for _, w := range snapshot.Windows {
+		phase.Windows = append(phase.Windows, newWindow(w, percentiles))
+	}
+	for _, a := range snapshot.Annotations {
+		phase.Annotations = append(phase.Annotations, Annotation{Time: a.Time, Message: a.Message})
+	}
+	return phase
+}
+
+func newRequestPhases(phases []stats.PhaseSnapshot, percentiles []float64) []RequestPhase {
+	if len(phases) == 0 {
+		return nil
+	}
+	converted := make([]RequestPhase, 0, len(phases))
+	for _, p := range phases {
+		converted = append(converted, RequestPhase{Name: p.Name, Latency: NewLatency(p.Latency, percentiles)})
+	}
+	return converted
+}
+
+// newTransfer converts sizes, bandwidth is calculated against the given phase duration.
+func newTransfer(t *stats.Transfer, duration time.Duration, percentiles []float64) *Transfer {
+	if t == nil {
+		return nil
+	}
+	transfer := &Transfer{
+		WireBytes:    t.Total.Wire(),
+		HeaderBytes:  t.Total.Headers,
+		BodyBytes:    t.Total.Body,
+		DecodedBytes: t.Total.Decoded,
+		Size: Size{
+			MeanBytes:   t.Sizes.Mean(),
+			MaxBytes:    t.Sizes.Max(),
+			Percentiles: make([]SizePercentile, 0, len(percentiles)),
+		},
+	}
+	if duration > 0 {
+		transfer.BytesPerSec = float64(transfer.WireBytes) / duration.Seconds()
+	}
+	for _, p := range percentiles {
+		v, err := t.Sizes.Percentile(p)
+		if err != nil {
+			continue
+		}
+		transfer.Size.Percentiles = append(transfer.Size.Percentiles, SizePercentile{Percentile: p, ValueBytes: v})
+	}
+	return transfer
+}
+
+func NewLatency(h *stats.Histogram, percentiles []float64) Latency {
+	latency := Latency{
+		MeanUs:      h.Mean().Microseconds(),
+		MinUs:       h.Min().Microseconds(),
+		MaxUs:       h.Max().Microseconds(),
+		Percentiles: make([]Percentile, 0, len(percentiles)),
+	}
+	for _, p := range percentiles {
+		v, err := h.Percentile(p)
+		if err != nil {
+			continue
+		}
+		latency.Percentiles = append(latency.Percentiles, Percentile{Percentile: p, ValueUs: v.Microseconds()})
+	}
+	return latency
+}
+
+func newWindow(w stats.Window, percentiles []float64) Window {
+	total := w.Total()
+	window := Window{
+		Start:         w.Start,
+		DurationMs:    w.Duration.Milliseconds(),
+		Count:         total.Count,
+		Errors:        total.Errors,
+		Throughput:    total.Throughput(w.Duration),
+		Latency:       NewLatency(total.Latency, percentiles),
+		SentBytes:     total.Sent,
+		ReceivedBytes: total.Received,
+		Reasons:       make([]WindowReason, 0, len(w.Series)),
+	}
+	for _, m := range w.Series {
+		window.Reasons = append(window.Reasons, WindowReason{
+			Reason:  m.Reason,
+			Tags:    m.Tags,
+			Count:   m.Count,
+			Errors:  m.Errors,
+			Latency: NewLatency(m.Latency, percentiles),
+		})
+	}
+	sort.Slice(window.Reasons, func(i, j int) bool {
+		a, b := window.Reasons[i], window.Reasons[j]
+		if a.Reason != b.Reason {
+			return a.Reason < b.Reason
+		}
+		return a.Tags.String() < b.Tags.String()
+	})
+	return window
+}
+
+// newErrorSamples converts samples, which are already sorted by frequency.
+func newErrorSamples(samples []stats.ErrorSample) []ErrorSample {
+	var converted []ErrorSample
+	for _, s := range samples {
+		converted = append(converted, ErrorSample{Message: s.Message, Count: s.Count, FirstSeen: s.FirstSeen, LastSeen: s.LastSeen})
+	}
+	return converted
+}
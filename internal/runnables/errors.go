@@ -0,0 +1,70 @@
+package runnables
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"syscall"
+)
+
+// Stable reasons of failed executions, so transport errors are told apart without reading messages.
+const (
+	ReasonRequestSetup      = "request_setup_error"
+	ReasonDNS               = "dns_error"
+	ReasonConnectionRefused = "connection_refused"
+	ReasonConnectionReset   = "connection_reset"
+	ReasonConnectionClosed  = "connection_closed" // the server closed the connection before responding
+	ReasonTLS               = "tls_error"
+	ReasonClientTimeout     = "client_timeout"   // http.Client.Timeout exceeded
+	ReasonContextDeadline   = "context_deadline" // deadline of the request context exceeded
+	ReasonContextCanceled   = "context_canceled"
+	ReasonTimeout           = "timeout" // any other network timeout, e.g. dialing
+	ReasonHttpError         = "http_error"
+)
+
+// ClassifyError maps a transport error to one of the stable reasons, falling back to fallback.
+func ClassifyError(err error, fallback string) string {
+	var (
+		dnsErr     *net.DNSError
+		urlErr     *url.Error
+		netErr     net.Error
+		recordErr  tls.RecordHeaderError
+		alertErr   tls.AlertError
+		verifyErr  *tls.CertificateVerificationError
+		unknownCA  x509.UnknownAuthorityError
+		hostErr    x509.HostnameError
+		invalidErr x509.CertificateInvalidError
+	)
+	switch {
+	case errors.As(err, &dnsErr):
+		return ReasonDNS
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return ReasonConnectionRefused
+	case errors.Is(err, syscall.ECONNRESET), errors.Is(err, syscall.EPIPE):
+		return ReasonConnectionReset
+	case errors.As(err, &recordErr), errors.As(err, &alertErr), errors.As(err, &verifyErr),
+		errors.As(err, &unknownCA), errors.As(err, &hostErr), errors.As(err, &invalidErr),
+		// alerts sent by the peer, e.g. on a version mismatch, aren't exported by crypto/tls
+		strings.Contains(err.Error(), "remote error: tls: "):
+		return ReasonTLS
+	// the client timeout satisfies context.DeadlineExceeded as well, so it's told apart by the message
+	case errors.As(err, &urlErr) && urlErr.Timeout() && strings.Contains(urlErr.Error(), "Client.Timeout"),
+		errors.Is(err, errStreamWait):
+		return ReasonClientTimeout
+	case errors.Is(err, context.DeadlineExceeded):
+		return ReasonContextDeadline
+	case errors.Is(err, context.Canceled):
+		return ReasonContextCanceled
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return ReasonTimeout
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return ReasonConnectionClosed
+	default:
+		return fallback
+	}
+}
@@ -0,0 +1,245 @@
+package runnables
+
+import (
+	"aggressive-pokes/internal/capture"
+	"aggressive-pokes/internal/ltlogger"
+	"aggressive-pokes/internal/stats"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Reasons of GraphQL responses which fail although the status code is 2xx.
+const (
+	ReasonGraphQLError           = "graphql_error"
+	ReasonGraphQLInvalidResponse = "graphql_invalid_response" // the body isn't a GraphQL response
+)
+
+// GraphQLConfig describes a GraphQL operation posted as JSON.
+type GraphQLConfig struct {
+	URL string
+	// Query is the document, it may define several operations, one of which is picked by OperationName
+	Query         string
+	OperationName string
+	// Variables is a JSON object, a Template rendered per request
+	Variables string
+	Headers   map[string]string
+	// PersistedQuery sends the hash of the query, along with the query only once the server doesn't know it
+	PersistedQuery bool
+	// MaxResponse bounds the response body kept for parsing, 10MB by default, larger responses fail as invalid
+	MaxResponse int
+}
+
+const defaultMaxGraphQLResponse = 10 << 20
+
+// Tags of persisted queries, telling requests which had to register the query apart.
+const (
+	PersistedQueryHit  = "hit"
+	PersistedQueryMiss = "miss"
+)
+
+// GraphQLRunnable posts the operation, invalid client config panics.
+func GraphQLRunnable(logger ltlogger.Logger, config GraphQLConfig, opts ...HttpOption) (func(reporter stats.Reporter), error) {
+	if config.URL == "" || strings.TrimSpace(config.Query) == "" {
+		return nil, errors.New("graphql requires url and query")
+	}
+	if config.MaxResponse < 0 {
+		return nil, errors.New("max response can't be negative")
+	}
+	if config.MaxResponse == 0 {
+		config.MaxResponse = defaultMaxGraphQLResponse
+	}
+	variables, err := NewTemplate(config.Variables, nil)
+	if err != nil {
+		return nil, fmt.Errorf("variables: %w", err)
+	}
+	// rendering once checks the variables are a JSON object
+	if _, err := graphQLVariables(variables); err != nil {
+		return nil, fmt.Errorf("variables: %w", err)
+	}
+	variables.reset()
+	options := newHttpOptions(opts)
+	if err := options.client.Validate(); err != nil {
+		panic(fmt.Sprintf("invalid http client config: %v", err))
+	}
+	options.client = options.client.withDefaultTimeout(30 * time.Second)
+	clients := newHttpClients(options.client)
+
+	g := &graphQL{config: config, variables: variables, options: options}
+	if config.PersistedQuery {
+		hash := sha256.Sum256([]byte(config.Query))
+		g.extensions = map[string]any{"persistedQuery": map[string]any{"version": 1, "sha256Hash": hex.EncodeToString(hash[:])}}
+	}
+	tags := stats.Tags{"operation": config.OperationName}
+	if config.OperationName == "" {
+		tags["operation"] = "anonymous"
+	}
+	logger.Info("Initialized graphql client", "url", config.URL, "operation", config.OperationName,
+		"persistedQuery", config.PersistedQuery, "timeout", options.client.Timeout)
+
+	return func(reporter stats.Reporter) {
+		start := time.Now()
+		vars, err := graphQLVariables(variables)
+		if err != nil {
+			reporter.ReportFailure(ReasonRequestSetup, err.Error(), time.Since(start))
+			return
+		}
+		reporter = reporter.WithTags(tags)
+
+		httpClient, err := clients.get(reporter.Context())
+		if err != nil {
+			reporter.ReportFailure(ClassifyError(err, ReasonHttpError), err.Error(), time.Since(start))
+			return
+		}
+		defer clients.release(httpClient)
+		if !config.PersistedQuery {
+			g.post(httpClient, reporter, start, vars, true)
+			return
+		}
+		if g.post(httpClient, reporter.WithTags(stats.Tags{"persisted": PersistedQueryHit}), start, vars, false) {
+			return
+		}
+		g.post(httpClient, reporter.WithTags(stats.Tags{"persisted": PersistedQueryMiss}), start, vars, true)
+	}, nil
+}
+
+type graphQL struct {
+	config     GraphQLConfig
+	variables  *Template
+	options    httpOptions
+	extensions map[string]any // hash of the persisted query
+}
+
+type graphQLRequest struct {
+	Query         string          `json:"query,omitempty"`
+	OperationName string          `json:"operationName,omitempty"`
+	Variables     json.RawMessage `json:"variables,omitempty"`
+	Extensions    map[string]any  `json:"extensions,omitempty"`
+}
+
+type graphQLResponse struct {
+	Data   json.RawMessage `json:"data"`
+	Errors []graphQLError  `json:"errors"`
+}
+
+type graphQLError struct {
+	Message    string         `json:"message"`
+	Path       []any          `json:"path"`
+	Extensions map[string]any `json:"extensions"`
+}
+
+// post sends the operation and reports it, unless the persisted query is unknown, which returns false.
+func (g *graphQL) post(httpClient *http.Client, reporter stats.Reporter, start time.Time, variables json.RawMessage, withQuery bool) bool {
+	body := graphQLRequest{OperationName: g.config.OperationName, Variables: variables, Extensions: g.extensions}
+	if withQuery {
+		body.Query = g.config.Query
+	}
+	payload, err := json.Marshal(body)
+	if err != nil {
+		reporter.ReportFailure(ReasonRequestSetup, err.Error(), time.Since(start))
+		return true
+	}
+	req, err := http.NewRequestWithContext(reporter.Context(), http.MethodPost, g.config.URL, bytes.NewReader(payload))
+	if err != nil {
+		reporter.ReportFailure(ReasonRequestSetup, err.Error(), time.Since(start))
+		return true
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/graphql-response+json, application/json")
+	for k, v := range g.config.Headers {
+		req.Header.Set(k, v)
+	}
+	x, err := send(httpClient, req, reporter.WithTags(g.options.tags(req)), start, g.options)
+	if err != nil {
+		x.fail(ClassifyError(err, ReasonHttpError), err)
+		return true
+	}
+
+	response := capture.NewBody(g.config.MaxResponse)
+	e, err := x.read(response)
+	if err != nil {
+		x.report(e, g.captured(e, x.res, response))
+		return true
+	}
+	var parsed graphQLResponse
+	parseErr := json.Unmarshal(response.Bytes(), &parsed)
+	if response.Truncated() {
+		parseErr = fmt.Errorf("response larger than %v bytes", g.config.MaxResponse)
+	}
+	// servers answer unknown hashes with 200 or 400 depending on the implementation
+	if !withQuery && parseErr == nil && len(parsed.Errors) > 0 && parsed.Errors[0].persistedQueryNotFound() {
+		return false
+	}
+	// responses other than 2xx are reported by status code, whatever errors they carry
+	if x.res.StatusCode/100 == 2 {
+		switch {
+		case parseErr != nil:
+			e.Reason, e.Failed, e.Message = ReasonGraphQLInvalidResponse, true, parseErr.Error()
+		case len(parsed.Errors) > 0:
+			e.Reason, e.Failed, e.Message = parsed.Errors[0].reason(), true, graphQLErrorsMessage(parsed.Errors)
+		case parsed.Data == nil:
+			e.Reason, e.Failed, e.Message = ReasonGraphQLInvalidResponse, true, "neither data nor errors"
+		}
+	}
+	x.report(e, g.captured(e, x.res, response))
+	return true
+}
+
+// captured returns the body to capture, nil unless the execution is picked for capture.
+func (g *graphQL) captured(e stats.Execution, res *http.Response, body *capture.Body) *capture.Body {
+	if g.options.capture == nil || !g.options.capture.ShouldCapture(e.Failed || res.StatusCode/100 != 2) {
+		return nil
+	}
+	kept := g.options.capture.NewBody()
+	_, _ = kept.Write(body.Bytes())
+	return kept
+}
+
+func graphQLVariables(variables *Template) (json.RawMessage, error) {
+	rendered, err := variables.Execute(nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(bytes.TrimSpace(rendered)) == 0 {
+		return nil, nil
+	}
+	if !json.Valid(rendered) || bytes.TrimSpace(rendered)[0] != '{' {
+		return nil, fmt.Errorf("should render a JSON object, got %s", rendered)
+	}
+	return rendered, nil
+}
+
+// reason names the error after its path without list indexes, or after its code.
+func (e graphQLError) reason() string {
+	var path []string
+	for _, segment := range e.Path {
+		if field, ok := segment.(string); ok {
+			path = append(path, field)
+		}
+	}
+	if len(path) > 0 {
+		return ReasonGraphQLError + ":" + strings.Join(path, ".")
+	}
+	if code, ok := e.Extensions["code"].(string); ok && code != "" {
+		return ReasonGraphQLError + ":" + code
+	}
+	return ReasonGraphQLError
+}
+
+func (e graphQLError) persistedQueryNotFound() bool {
+	code, _ := e.Extensions["code"].(string)
+	return code == "PERSISTED_QUERY_NOT_FOUND" || e.Message == "PersistedQueryNotFound"
+}
+
+func graphQLErrorsMessage(errs []graphQLError) string {
+	if len(errs) == 1 {
+		return errs[0].Message
+	}
+	return fmt.Sprintf("%v (and %v more)", errs[0].Message, len(errs)-1)
+}
@@ -0,0 +1,152 @@
+package runnables
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const testQuery = "query User($id: ID!) { user(id: $id) { name } }"
+
+// persistedServer follows automatic persisted queries, registering a query once it's sent along with its hash.
+type persistedServer struct {
+	*httptest.Server
+	known    map[string]bool
+	requests int
+	mx       *sync.Mutex
+}
+
+func newPersistedServer(t *testing.T) *persistedServer {
+	s := &persistedServer{known: make(map[string]bool), mx: &sync.Mutex{}}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req graphQLRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		hash, _ := req.Extensions["persistedQuery"].(map[string]any)["sha256Hash"].(string)
+
+		s.mx.Lock()
+		defer s.mx.Unlock()
+		s.requests++
+		if req.Query != "" {
+			sum := sha256.Sum256([]byte(req.Query))
+			if hex.EncodeToString(sum[:]) != hash {
+				http.Error(w, "hash mismatch", http.StatusBadRequest)
+				return
+			}
+			s.known[hash] = true
+		}
+		if !s.known[hash] {
+			_, _ = w.Write([]byte(`{"errors":[{"message":"PersistedQueryNotFound","extensions":{"code":"PERSISTED_QUERY_NOT_FOUND"}}]}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"data":{"user":{"name":"a"}}}`))
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// served returns and resets the amount of requests served.
+func (s *persistedServer) served() int {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	n := s.requests
+	s.requests = 0
+	return n
+}
+
+func TestGraphQLPersistedQuery(t *testing.T) {
+	srv := newPersistedServer(t)
+	runnable, err := GraphQLRunnable(testLogger(), GraphQLConfig{URL: srv.URL, Query: testQuery, OperationName: "User", Variables: `{"id": "1"}`, PersistedQuery: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []struct {
+		persisted string
+		requests  int
+	}{
+		{PersistedQueryMiss, 2},
+		{PersistedQueryHit, 1},
+	} {
+		rec, reporter := newRecorder()
+		runnable(reporter)
+		e := rec.single(t)
+		if e.Failed || e.Reason != "200" {
+			t.Errorf("reported %v failed %v: %v, want 200", e.Reason, e.Failed, e.Message)
+		}
+		if e.Tags["persisted"] != want.persisted || e.Tags["operation"] != "User" {
+			t.Errorf("tagged %v, want persisted %v of operation User", e.Tags, want.persisted)
+		}
+		if n := srv.served(); n != want.requests {
+			t.Errorf("%v: sent %v requests, want %v", want.persisted, n, want.requests)
+		}
+	}
+}
+
+func TestGraphQLResponses(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      int
+		body        string
+		maxResponse int
+		reason      string
+		failed      bool
+	}{
+		{name: "data", status: http.StatusOK, body: `{"data":{"user":{"name":"a"}}}`, reason: "200"},
+		{name: "error with path", status: http.StatusOK, body: `{"data":null,"errors":[{"message":"boom","path":["user",0,"name"]}]}`, reason: "graphql_error:user.name", failed: true},
+		{name: "neither data nor errors", status: http.StatusOK, body: `{}`, reason: ReasonGraphQLInvalidResponse, failed: true},
+		{name: "not json", status: http.StatusOK, body: `<html>`, reason: ReasonGraphQLInvalidResponse, failed: true},
+		{name: "truncated", status: http.StatusOK, body: `{"data":{"user":{"name":"` + strings.Repeat("a", 100) + `"}}}`, maxResponse: 64, reason: ReasonGraphQLInvalidResponse, failed: true},
+		{name: "status wins over errors", status: http.StatusInternalServerError, body: `{"errors":[{"message":"boom"}]}`, reason: "500", failed: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				_, _ = w.Write([]byte(tt.body))
+			}))
+			defer srv.Close()
+			runnable, err := GraphQLRunnable(testLogger(), GraphQLConfig{URL: srv.URL, Query: testQuery, MaxResponse: tt.maxResponse})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rec, reporter := newRecorder()
+			runnable(reporter)
+			e := rec.single(t)
+			if e.Reason != tt.reason || e.Failed != tt.failed {
+				t.Errorf("reported %v failed %v: %v, want %v failed %v", e.Reason, e.Failed, e.Message, tt.reason, tt.failed)
+			}
+			if e.Tags["operation"] != "anonymous" {
+				t.Errorf("tagged operation %v, want anonymous", e.Tags["operation"])
+			}
+		})
+	}
+}
+
+func TestGraphQLErrorReason(t *testing.T) {
+	tests := []struct {
+		name string
+		err  graphQLError
+		want string
+	}{
+		{name: "path", err: graphQLError{Path: []any{"user", "posts"}}, want: "graphql_error:user.posts"},
+		{name: "list indexes left out", err: graphQLError{Path: []any{"users", float64(3), "posts", float64(0), "title"}}, want: "graphql_error:users.posts.title"},
+		{name: "code without path", err: graphQLError{Extensions: map[string]any{"code": "BAD_USER_INPUT"}}, want: "graphql_error:BAD_USER_INPUT"},
+		{name: "path over code", err: graphQLError{Path: []any{"user"}, Extensions: map[string]any{"code": "FORBIDDEN"}}, want: "graphql_error:user"},
+		{name: "neither", err: graphQLError{Message: "boom"}, want: ReasonGraphQLError},
+		{name: "indexes only", err: graphQLError{Path: []any{float64(0)}}, want: ReasonGraphQLError},
+	}
+	for _, tt := range tests {
+		if got := tt.err.reason(); got != tt.want {
+			t.Errorf("%v: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package runnables
+
+import (
+	"aggressive-pokes/internal/ltlogger"
+	"aggressive-pokes/internal/stats"
+	"context"
+	"errors"
+	"fmt"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"io"
+	"strings"
+	"time"
+)
+
+// GrpcConfig describes calls of a gRPC method. Descriptors of the method come from DescriptorSet, ProtoFile
+// or server reflection, in this order.
+type GrpcConfig struct {
+	// Address is host:port of the server
+	Address string
+	// Method is the full name, e.g. helloworld.Greeter/SayHello
+	Method string
+	// Body is the JSON request message, a Template rendered per call
+	Body     string
+	Metadata map[string]string
+	// Timeout is the deadline of each call including reading a stream, 5s by default
+	Timeout time.Duration
+	// DescriptorSet is a file written by protoc --include_imports --descriptor_set_out
+	DescriptorSet string
+	// ProtoFile is compiled by protoc, which must be on PATH, ImportPaths are passed as -I
+	ProtoFile   string
+	ImportPaths []string
+	// Plaintext disables TLS, which is configured by TLS otherwise
+	Plaintext bool
+	TLS       TLSConfig
+}
+
+// Reasons of gRPC calls are grpc_ followed by the status code, e.g. grpc_ok or grpc_deadline_exceeded.
+const grpcReasonPrefix = "grpc_"
+
+func grpcReason(err error) string {
+	return grpcReasonPrefix + snakeCase(status.Code(err).String())
+}
+
+// GrpcRunnable calls a unary or server-streaming method, reporting the status code as the reason.
+// Server streams are read to the end, the first message marks the ttfb phase.
+func GrpcRunnable(logger ltlogger.Logger, config GrpcConfig) (func(reporter stats.Reporter), error) {
+	if config.Address == "" || config.Method == "" {
+		return nil, errors.New("grpc requires address and method")
+	}
+	service, name, ok := strings.Cut(strings.TrimPrefix(config.Method, "/"), "/")
+	if !ok {
+		return nil, fmt.Errorf("method [%v] should look like package.Service/Method", config.Method)
+	}
+	if config.Timeout == 0 {
+		config.Timeout = 5 * time.Second
+	}
+	body, err := NewTemplate(config.Body, nil)
+	if err != nil {
+		return nil, fmt.Errorf("body: %w", err)
+	}
+	creds := insecure.NewCredentials()
+	if !config.Plaintext {
+		tlsConfig, err := config.TLS.build()
+		if err != nil {
+			return nil, fmt.Errorf("tls: %w", err)
+		}
+		creds = credentials.NewTLS(tlsConfig)
+	}
+	conn, err := grpc.Dial(config.Address, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return nil, err
+	}
+
+	method, err := resolveMethod(conn, config, protoreflect.FullName(service), protoreflect.Name(name))
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	if method.IsStreamingClient() {
+		_ = conn.Close()
+		return nil, fmt.Errorf("method [%v] streams from the client, only unary and server-streaming methods are supported", config.Method)
+	}
+	// rendering once checks the body matches the request message
+	if _, err := grpcRequest(method, body); err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("body: %w", err)
+	}
+	// so the first request still renders {{ seq }} as 0
+	body.reset()
+
+	fullMethod := fmt.Sprintf("/%v/%v", service, name)
+	md := metadata.New(config.Metadata)
+	headers := int64(0)
+	for k, v := range config.Metadata {
+		headers += int64(len(k) + len(v))
+	}
+	tags := stats.Tags{"endpoint": fullMethod}
+	logger.Info("Initialized grpc client", "address", config.Address, "method", fullMethod,
+		"streaming", method.IsStreamingServer(), "timeout", config.Timeout)
+
+	return func(reporter stats.Reporter) {
+		reporter = reporter.WithTags(tags)
+		start := time.Now()
+		req, err := grpcRequest(method, body)
+		if err != nil {
+			reporter.ReportFailure(ReasonRequestSetup, err.Error(), time.Since(start))
+			return
+		}
+		ctx, cancel := context.WithTimeout(metadata.NewOutgoingContext(context.Background(), md), config.Timeout)
+		defer cancel()
+
+		sent := stats.Size{Headers: headers, Body: int64(proto.Size(req)), Decoded: int64(proto.Size(req))}
+		var (
+			received  stats.Size
+			firstByte time.Time
+		)
+		if method.IsStreamingServer() {
+			received, firstByte, err = grpcServerStream(ctx, conn, fullMethod, method, req)
+		} else {
+			res := dynamicpb.NewMessage(method.Output())
+			if err = conn.Invoke(ctx, fullMethod, req, res); err == nil {
+				received.Body = int64(proto.Size(res))
+			}
+		}
+		end := time.Now()
+		received.Decoded = received.Body
+
+		e := stats.Execution{Time: end, Elapsed: end.Sub(start), Sent: sent, Received: received}
+		e.Reason = grpcReason(err)
+		if err != nil {
+			e.Failed, e.Message = true, err.Error()
+		}
+		if !firstByte.IsZero() {
+			e.Phases = appendPhase(e.Phases, PhaseTTFB, start, firstByte)
+			e.Phases = appendPhase(e.Phases, PhaseTransfer, firstByte, end)
+		}
+		reporter.ReportExecution(e)
+	}, nil
+}
+
+func grpcRequest(method protoreflect.MethodDescriptor, body *Template) (*dynamicpb.Message, error) {
+	rendered, err := body.Execute(nil)
+	if err != nil {
+		return nil, err
+	}
+	req := dynamicpb.NewMessage(method.Input())
+	if len(strings.TrimSpace(string(rendered))) == 0 {
+		return req, nil
+	}
+	return req, protojson.Unmarshal(rendered, req)
+}
+
+// grpcServerStream reads every message of the stream, returning their size and when the first one arrived.
+func grpcServerStream(ctx context.Context, conn *grpc.ClientConn, fullMethod string, method protoreflect.MethodDescriptor, req proto.Message) (stats.Size, time.Time, error) {
+	var (
+		size      stats.Size
+		firstByte time.Time
+	)
+	stream, err := conn.NewStream(ctx, &grpc.StreamDesc{ServerStreams: true}, fullMethod)
+	if err != nil {
+		return size, firstByte, err
+	}
+	if err := stream.SendMsg(req); err != nil {
+		return size, firstByte, err
+	}
+	if err := stream.CloseSend(); err != nil {
+		return size, firstByte, err
+	}
+	for {
+		res := dynamicpb.NewMessage(method.Output())
+		if err := stream.RecvMsg(res); err != nil {
+			if errors.Is(err, io.EOF) {
+				return size, firstByte, nil
+			}
+			return size, firstByte, err
+		}
+		if firstByte.IsZero() {
+			firstByte = time.Now()
+		}
+		size.Body += int64(proto.Size(res))
+	}
+}
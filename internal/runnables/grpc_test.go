@@ -0,0 +1,23 @@
+package runnables
+
+import (
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"testing"
+)
+
+func TestGrpcReason(t *testing.T) {
+	for _, tt := range []struct {
+		err  error
+		want string
+	}{
+		{nil, "grpc_ok"},
+		{status.Error(codes.DeadlineExceeded, "slow"), "grpc_deadline_exceeded"},
+		{status.Error(codes.Unavailable, "down"), "grpc_unavailable"},
+		{status.Error(codes.ResourceExhausted, "full"), "grpc_resource_exhausted"},
+	} {
+		if got := grpcReason(tt.err); got != tt.want {
+			t.Errorf("%v: got %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package runnables
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"google.golang.org/grpc"
+	rpb "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+)
+
+// reflectionTimeout bounds fetching descriptors from the server when the runnable is built.
+const reflectionTimeout = 10 * time.Second
+
+// resolveMethod finds the descriptor of service/name in the configured source.
+func resolveMethod(conn *grpc.ClientConn, config GrpcConfig, service protoreflect.FullName, name protoreflect.Name) (protoreflect.MethodDescriptor, error) {
+	var (
+		set *descriptorpb.FileDescriptorSet
+		err error
+	)
+	switch {
+	case config.DescriptorSet != "":
+		set, err = readDescriptorSet(config.DescriptorSet)
+	case config.ProtoFile != "":
+		set, err = compileProto(config.ProtoFile, config.ImportPaths)
+	default:
+		set, err = reflectDescriptors(conn, service)
+	}
+	if err != nil {
+		return nil, err
+	}
+	files, err := protodesc.NewFiles(set)
+	if err != nil {
+		return nil, fmt.Errorf("descriptors: %w", err)
+	}
+	d, err := files.FindDescriptorByName(service)
+	if err != nil {
+		return nil, fmt.Errorf("service [%v]: %w", service, err)
+	}
+	sd, ok := d.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("[%v] isn't a service", service)
+	}
+	method := sd.Methods().ByName(name)
+	if method == nil {
+		return nil, fmt.Errorf("service [%v] has no method [%v]", service, name)
+	}
+	return method, nil
+}
+
+func readDescriptorSet(path string) (*descriptorpb.FileDescriptorSet, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	set := &descriptorpb.FileDescriptorSet{}
+	if err := proto.Unmarshal(b, set); err != nil {
+		return nil, fmt.Errorf("descriptor set [%v]: %w", path, err)
+	}
+	return set, nil
+}
+
+// compileProto runs protoc, there's no .proto parser among the dependencies.
+func compileProto(path string, importPaths []string) (*descriptorpb.FileDescriptorSet, error) {
+	protoc, err := exec.LookPath("protoc")
+	if err != nil {
+		return nil, fmt.Errorf("compiling [%v] requires protoc on PATH, or use a descriptor set: %w", path, err)
+	}
+	dir, err := os.MkdirTemp("", "pokes-proto")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	out := filepath.Join(dir, "descriptors.pb")
+	args := []string{"--include_imports", "--descriptor_set_out=" + out}
+	if len(importPaths) == 0 {
+		importPaths = []string{filepath.Dir(path)}
+	}
+	for _, p := range importPaths {
+		args = append(args, "-I", p)
+	}
+	var stderr bytes.Buffer
+	cmd := exec.Command(protoc, append(args, path)...)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("protoc [%v]: %w: %s", path, err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return readDescriptorSet(out)
+}
+
+// reflectDescriptors asks the server for the file defining service along with its dependencies.
+// Dependencies the server doesn't return, e.g. well-known types, are taken from the linked-in registry.
+func reflectDescriptors(conn *grpc.ClientConn, service protoreflect.FullName) (*descriptorpb.FileDescriptorSet, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), reflectionTimeout)
+	defer cancel()
+	stream, err := rpb.NewServerReflectionClient(conn).ServerReflectionInfo(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("reflection: %w", err)
+	}
+	defer stream.CloseSend()
+
+	set := &descriptorpb.FileDescriptorSet{}
+	loaded := make(map[string]bool)
+	pending := []*rpb.ServerReflectionRequest{{
+		MessageRequest: &rpb.ServerReflectionRequest_FileContainingSymbol{FileContainingSymbol: string(service)},
+	}}
+	for len(pending) > 0 {
+		req := pending[0]
+		pending = pending[1:]
+		if err := stream.Send(req); err != nil {
+			return nil, fmt.Errorf("reflection: %w", err)
+		}
+		res, err := stream.Recv()
+		if err != nil {
+			return nil, fmt.Errorf("reflection: %w", err)
+		}
+		if e := res.GetErrorResponse(); e != nil {
+			return nil, fmt.Errorf("reflection of [%v]: %v", service, e.GetErrorMessage())
+		}
+		for _, b := range res.GetFileDescriptorResponse().GetFileDescriptorProto() {
+			file := &descriptorpb.FileDescriptorProto{}
+			if err := proto.Unmarshal(b, file); err != nil {
+				return nil, fmt.Errorf("reflection: %w", err)
+			}
+			if loaded[file.GetName()] {
+				continue
+			}
+			loaded[file.GetName()] = true
+			set.File = append(set.File, file)
+			for _, dep := range file.GetDependency() {
+				if loaded[dep] {
+					continue
+				}
+				if linked, err := protoregistry.GlobalFiles.FindFileByPath(dep); err == nil {
+					addLinkedFile(set, loaded, linked)
+					continue
+				}
+				pending = append(pending, &rpb.ServerReflectionRequest{
+					MessageRequest: &rpb.ServerReflectionRequest_FileByFilename{FileByFilename: dep},
+				})
+			}
+		}
+	}
+	return set, nil
+}
+
+func addLinkedFile(set *descriptorpb.FileDescriptorSet, loaded map[string]bool, file protoreflect.FileDescriptor) {
+	if loaded[file.Path()] {
+		return
+	}
+	loaded[file.Path()] = true
+	set.File = append(set.File, protodesc.ToFileDescriptorProto(file))
+	for i := 0; i < file.Imports().Len(); i++ {
+		addLinkedFile(set, loaded, file.Imports().Get(i).FileDescriptor)
+	}
+}
@@ -1,66 +1,112 @@
 package runnables
 
 import (
+	"aggressive-pokes/internal/capture"
 	"aggressive-pokes/internal/ltlogger"
 	"aggressive-pokes/internal/stats"
 	"bytes"
+	"compress/gzip"
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"strconv"
 	"time"
 )
 
-func HttpRunnableWithSupplier(supplier *HttpRequestSupplier) func(reporter stats.Reporter) {
-	httpClient := &http.Client{
-		Transport: &http.Transport{
-			MaxIdleConns:        1000,
-			MaxConnsPerHost:     1000,
-			MaxIdleConnsPerHost: 1000,
-		},
-		Timeout: 30 * time.Second,
+// HttpOption tunes HTTP runnables beyond the requests they send.
+type HttpOption func(o *httpOptions)
+
+type httpOptions struct {
+	capture  *capture.Capturer
+	client   HttpClientConfig
+	fail4xx  bool
+	endpoint string
+}
+
+// WithCapture saves failed requests, i.e. transport errors and non-2xx responses, along with a sample
+// of successful ones into c.
+func WithCapture(c *capture.Capturer) HttpOption {
+	return func(o *httpOptions) {
+		o.capture = c
+	}
+}
+
+// WithClient replaces the default client settings, invalid config panics so check it with HttpClientConfig.Validate first.
+func WithClient(config HttpClientConfig) HttpOption {
+	return func(o *httpOptions) {
+		o.client = config
+	}
+}
+
+// WithFail4xx fails executions which got a 4xx response, 5xx responses always fail.
+func WithFail4xx() HttpOption {
+	return func(o *httpOptions) {
+		o.fail4xx = true
+	}
+}
+
+// statusFailed tells whether a response with status fails the execution, so it counts into the error rate.
+func (o httpOptions) statusFailed(status int) bool {
+	return status >= 500 || o.fail4xx && status >= 400
+}
+
+// WithEndpoint tags executions by endpoint, a route template such as /users/{id}. Executions aren't tagged
+// by their URL path, as paths of templated requests would make series unbounded.
+func WithEndpoint(route string) HttpOption {
+	return func(o *httpOptions) {
+		o.endpoint = route
+	}
+}
+
+func newHttpOptions(opts []HttpOption) httpOptions {
+	var o httpOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+func HttpRunnableWithSupplier(supplier *HttpRequestSupplier, opts ...HttpOption) func(reporter stats.Reporter) {
+	options := newHttpOptions(opts)
+	if err := options.client.Validate(); err != nil {
+		panic(fmt.Sprintf("invalid http client config: %v", err))
 	}
+	options.client = options.client.withDefaultTimeout(30 * time.Second)
+	clients := newHttpClients(options.client)
 
-	supplier.logger.Info("Initialized http client", "url", supplier.url, "timeout", httpClient.Timeout)
+	supplier.logger.Info("Initialized http client", "url", supplier.url, "timeout", options.client.Timeout,
+		"newClientPerRequest", options.client.NewClientPerRequest)
 
 	return func(reporter stats.Reporter) {
 		start := time.Now()
 		req, err := supplier.request()
 		if err != nil {
-			reporter.ReportFailure("request_setup_error", err.Error(), time.Since(start))
+			reporter.ReportFailure(ReasonRequestSetup, err.Error(), time.Since(start))
 			return
 		}
+		reporter = reporter.WithTags(options.tags(req))
 
-		res, err := httpClient.Do(req)
+		httpClient, err := clients.get(req.Context())
 		if err != nil {
-			if res == nil {
-				if errors.As(err, &http.ErrHandlerTimeout) {
-					reporter.ReportFailure("http_timeout", err.Error(), time.Since(start))
-				} else {
-					reporter.ReportFailure("http_error", err.Error(), time.Since(start))
-				}
-			}
-		} else {
-			if res.Body != nil {
-				_, _ = io.Copy(io.Discard, res.Body)
-				defer res.Body.Close()
-			}
-			reporter.Report(strconv.Itoa(res.StatusCode), time.Since(start))
+			reporter.ReportFailure(ClassifyError(err, ReasonHttpError), err.Error(), time.Since(start))
+			return
 		}
+		do(httpClient, req, reporter, start, options)
+		clients.release(httpClient)
 	}
 }
 
-func HttpRunnable(logger ltlogger.Logger, url string, body []byte, headers map[string]string) func(reporter stats.Reporter) {
-	httpClient := &http.Client{
-		Transport: &http.Transport{
-			MaxIdleConns:        1000,
-			MaxConnsPerHost:     1000,
-			MaxIdleConnsPerHost: 1000,
-		},
-		Timeout: 5 * time.Second,
+func HttpRunnable(logger ltlogger.Logger, url string, body []byte, headers map[string]string, opts ...HttpOption) func(reporter stats.Reporter) {
+	options := newHttpOptions(opts)
+	if err := options.client.Validate(); err != nil {
+		panic(fmt.Sprintf("invalid http client config: %v", err))
 	}
+	options.client = options.client.withDefaultTimeout(5 * time.Second)
+	clients := newHttpClients(options.client)
 
-	logger.Info("Initialized http client", "url", url, "timeout", httpClient.Timeout)
+	logger.Info("Initialized http client", "url", url, "timeout", options.client.Timeout,
+		"newClientPerRequest", options.client.NewClientPerRequest)
 
 	return func(reporter stats.Reporter) {
 		start := time.Now()
@@ -69,25 +115,219 @@ func HttpRunnable(logger ltlogger.Logger, url string, body []byte, headers map[s
 			req.Header.Set(k, v)
 		}
 		if err != nil {
-			reporter.ReportFailure("request_setup_error", err.Error(), time.Since(start))
+			reporter.ReportFailure(ReasonRequestSetup, err.Error(), time.Since(start))
+			return
+		}
+		reporter = reporter.WithTags(options.tags(req))
+
+		httpClient, err := clients.get(req.Context())
+		if err != nil {
+			reporter.ReportFailure(ClassifyError(err, ReasonHttpError), err.Error(), time.Since(start))
 			return
 		}
+		do(httpClient, req, reporter, start, options)
+		clients.release(httpClient)
+	}
+}
+
+// tags split stats of mixed workloads by method, and by endpoint if one is configured.
+func (o httpOptions) tags(req *http.Request) stats.Tags {
+	tags := stats.Tags{"method": req.Method}
+	if o.endpoint != "" {
+		tags["endpoint"] = o.endpoint
+	}
+	return tags
+}
+
+// do executes req and reports its outcome along with timing phases and sizes of the request.
+func do(httpClient *http.Client, req *http.Request, reporter stats.Reporter, start time.Time, options httpOptions) {
+	x, err := send(httpClient, req, reporter, start, options)
+	if err != nil {
+		x.fail(ClassifyError(err, ReasonHttpError), err)
+		return
+	}
+	var body *capture.Body
+	if options.capture != nil {
+		body = options.capture.NewBody()
+	}
+	e, _ := x.read(body)
+	// reading may fail a request with a successful status, so whether to capture is decided afterwards
+	if body != nil && !options.capture.ShouldCapture(e.Failed || x.res.StatusCode/100 != 2) {
+		body = nil
+	}
+	x.report(e, body)
+}
+
+// exchange is a request sent by one of the HTTP runnables, which share timing, reading, reporting and capturing it.
+type exchange struct {
+	req      *http.Request
+	res      *http.Response // nil unless a response arrived
+	reporter stats.Reporter
+	options  httpOptions
+	start    time.Time
+	timer    *requestTimer
+	sent     stats.Size
+	decode   bool // gzip is decoded by the runnable, as the transport doesn't once asked for gzip explicitly
+}
+
+// send sends req, timing its phases. The error is the transport error, which callers classify and report with fail.
+func send(httpClient *http.Client, req *http.Request, reporter stats.Reporter, start time.Time, options httpOptions) (*exchange, error) {
+	x := &exchange{req: req, reporter: reporter, options: options, start: start, timer: newRequestTimer()}
+	// asking for gzip explicitly keeps the transport from decoding transparently, so compressed sizes can be counted
+	if x.decode = req.Header.Get("Accept-Encoding") == ""; x.decode {
+		req.Header.Set("Accept-Encoding", "gzip")
+	}
+	x.sent = requestSize(req)
+	var err error
+	x.res, err = httpClient.Do(x.timer.trace(req))
+	return x, err
+}
+
+// fail reports and captures a request which got no response.
+func (x *exchange) fail(reason string, err error) {
+	e := x.timer.execution(reason, x.start, time.Now())
+	e.Failed, e.Message, e.Sent = true, err.Error(), x.sent
+	x.reporter.ReportExecution(e)
+	if x.options.capture != nil {
+		x.options.capture.Capture(captureRecord(x.options.capture, e, x.req, nil, nil))
+	}
+}
+
+// read drains the response, keeping its body in keep unless it's nil. The execution is timed up to now and named
+// after the status code, it fails when the status does or with the error reading the body, which is returned too.
+func (x *exchange) read(keep *capture.Body) (stats.Execution, error) {
+	received, err := readResponse(x.res, x.decode, keep)
+	e := x.timer.execution(strconv.Itoa(x.res.StatusCode), x.start, time.Now())
+	e.Sent, e.Received = x.sent, received
+	e.Protocol = negotiatedProtocol(x.res)
+	switch {
+	case err != nil:
+		e.Reason, e.Failed, e.Message = ClassifyError(err, ReasonHttpError), true, err.Error()
+	case x.options.statusFailed(x.res.StatusCode):
+		e.Failed, e.Message = true, x.res.Status
+	}
+	return e, err
+}
+
+// report reports e, capturing it along with the response body unless body is nil, i.e. it wasn't picked for capture.
+func (x *exchange) report(e stats.Execution, body *capture.Body) {
+	x.reporter.ReportExecution(e)
+	if body != nil {
+		x.options.capture.Capture(captureRecord(x.options.capture, e, x.req, x.res, body))
+	}
+}
+
+// captureRecord pairs the request with the response, which is nil when the request failed before one arrived.
+func captureRecord(c *capture.Capturer, e stats.Execution, req *http.Request, res *http.Response, body *capture.Body) capture.Record {
+	r := capture.Record{
+		Time:      e.Time,
+		Reason:    e.Reason,
+		Failed:    e.Failed || res != nil && res.StatusCode/100 != 2,
+		ElapsedUs: e.Elapsed.Microseconds(),
+		Error:     e.Message,
+		Request:   capture.Message{Method: req.Method, URL: req.URL.String(), Headers: req.Header},
+	}
+	// GetBody replays bodies of requests built from in-memory readers, which is what suppliers do
+	if req.GetBody != nil {
+		if rc, err := req.GetBody(); err == nil {
+			reqBody := c.NewBody()
+			_, _ = io.Copy(reqBody, rc)
+			_ = rc.Close()
+			r.Request.Body, r.Request.BodyTruncated = reqBody.String(), reqBody.Truncated()
+		}
+	}
+	if res != nil {
+		r.Response = &capture.Message{Status: res.StatusCode, Headers: res.Header, Body: body.String(), BodyTruncated: body.Truncated()}
+	}
+	return r
+}
+
+// requestSize approximates the request as written by HTTP/1.1, headers added by the transport itself,
+// e.g. User-Agent, are left out.
+func requestSize(req *http.Request) stats.Size {
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	headers := &byteCounter{}
+	fmt.Fprintf(headers, "%v %v HTTP/1.1\r\nHost: %v\r\n", req.Method, req.URL.RequestURI(), host)
+	_ = req.Header.Write(headers)
+	headers.n += 2
 
-		res, err := httpClient.Do(req)
+	size := stats.Size{Headers: headers.n}
+	if req.ContentLength > 0 {
+		size.Body, size.Decoded = req.ContentLength, req.ContentLength
+	}
+	return size
+}
+
+// readResponse drains and closes the response body, counting it as transferred and after decoding gzip if decode is set.
+// The decoded body is kept in keep unless it's nil. Sizes count what was read before an error, e.g. a broken connection
+// or a body which isn't gzip after all.
+func readResponse(res *http.Response, decode bool, keep *capture.Body) (stats.Size, error) {
+	size := responseHeaderSize(res)
+	if res.Body == nil {
+		return size, nil
+	}
+	defer res.Body.Close()
+
+	var sink io.Writer = io.Discard
+	if keep != nil {
+		sink = keep
+	}
+	raw := &countingReader{r: res.Body}
+	var err error
+	if decode && res.Header.Get("Content-Encoding") == "gzip" {
+		var gz *gzip.Reader
+		switch gz, err = gzip.NewReader(raw); {
+		case err == nil:
+			size.Decoded, err = io.Copy(sink, gz)
+			sink = io.Discard
+		case errors.Is(err, io.EOF):
+			// an empty body, e.g. of a 204
+			err = nil
+		}
 		if err != nil {
-			if res == nil {
-				if errors.As(err, &http.ErrHandlerTimeout) {
-					reporter.ReportFailure("http_timeout", err.Error(), time.Since(start))
-				} else {
-					reporter.ReportFailure("http_error", err.Error(), time.Since(start))
-				}
-			}
-		} else {
-			if res.Body != nil {
-				_, _ = io.Copy(io.Discard, res.Body)
-				defer res.Body.Close()
-			}
-			reporter.Report(strconv.Itoa(res.StatusCode), time.Since(start))
+			err = fmt.Errorf("decode gzip body: %w", err)
 		}
 	}
+	// drains whatever wasn't decoded, so the connection can be reused
+	drained, drainErr := io.Copy(sink, raw)
+	size.Body = raw.n
+	if size.Decoded == 0 {
+		size.Decoded = drained
+	}
+	if err == nil && drainErr != nil {
+		err = fmt.Errorf("read body: %w", drainErr)
+	}
+	return size, err
+}
+
+// responseHeaderSize counts the status line and headers as written by HTTP/1.1.
+func responseHeaderSize(res *http.Response) stats.Size {
+	headers := &byteCounter{}
+	fmt.Fprintf(headers, "%v %v\r\n", res.Proto, res.Status)
+	_ = res.Header.Write(headers)
+	headers.n += 2
+	return stats.Size{Headers: headers.n}
+}
+
+type byteCounter struct {
+	n int64
+}
+
+func (c *byteCounter) Write(p []byte) (int, error) {
+	c.n += int64(len(p))
+	return len(p), nil
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
 }
@@ -0,0 +1,253 @@
+package runnables
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"golang.org/x/net/http2"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// Protocols HTTP runnables speak.
+const (
+	ProtocolHTTP1 = "http1" // HTTP/1.1 only over a pool of connections
+	ProtocolHTTP2 = "http2" // HTTP/2 over TLS negotiated via ALPN, https URLs only
+	ProtocolH2C   = "h2c"   // cleartext HTTP/2 with prior knowledge, http URLs only
+)
+
+const defaultMaxConcurrentStreams = 100
+
+func multiplexed(protocol string) bool {
+	return protocol == ProtocolHTTP2 || protocol == ProtocolH2C
+}
+
+// newHttp2Transport multiplexes requests over a pool of HTTP/2 connections.
+func (c HttpClientConfig) newHttp2Transport(dial func(ctx context.Context, network, addr string) (net.Conn, error), tlsConfig *tls.Config) http.RoundTripper {
+	pool := &http2Pool{
+		protocol:   c.Protocol,
+		dial:       dial,
+		tls:        tlsConfig,
+		tlsTimeout: c.TLSHandshakeTimeout,
+		maxConns:   orDefault(c.MaxConnsPerHost, defaultMaxConns),
+		maxStreams: orDefault(c.MaxConcurrentStreams, defaultMaxConcurrentStreams),
+		conns:      make(map[string][]*http2.ClientConn),
+		dialing:    make(map[string]int),
+		waiting:    make(map[string]int),
+		dialed:     make(chan struct{}),
+		mx:         &sync.Mutex{},
+	}
+	// schemes are checked by the pool, which tells http2 and h2c apart. Streams beyond the limit of the server
+	// queue on the connection rather than failing the reservation
+	pool.transport = &http2.Transport{ConnPool: pool, AllowHTTP: true, StrictMaxConcurrentStreams: true}
+	return &http2Transport{Transport: pool.transport, pool: pool}
+}
+
+// http2Transport closes idle connections of its pool, which http2.Transport only does for its own pool.
+type http2Transport struct {
+	*http2.Transport
+	pool *http2Pool
+}
+
+func (t *http2Transport) CloseIdleConnections() {
+	t.pool.closeIdle()
+}
+
+// http2Pool spreads streams over up to maxConns connections per host, opening another one only once
+// every connection carries maxStreams streams, or fewer if the server allows fewer. Streams beyond that
+// queue on the connections once maxConns are open.
+type http2Pool struct {
+	protocol   string
+	transport  *http2.Transport
+	dial       func(ctx context.Context, network, addr string) (net.Conn, error)
+	tls        *tls.Config
+	tlsTimeout time.Duration
+	maxConns   int
+	maxStreams int
+	conns      map[string][]*http2.ClientConn // guarded by mx
+	dialing    map[string]int                 // guarded by mx
+	waiting    map[string]int                 // requests waiting for connections being dialed, guarded by mx
+	dialed     chan struct{}                  // closed and replaced whenever a dial ends, guarded by mx
+	mx         *sync.Mutex
+}
+
+// GetClientConn waits for connections being dialed only as long as the request context allows, which carries
+// the client timeout as well.
+func (p *http2Pool) GetClientConn(req *http.Request, addr string) (*http2.ClientConn, error) {
+	p.mx.Lock()
+	defer p.mx.Unlock()
+	for {
+		cc, streams, room := p.leastLoaded(addr)
+		atMax := len(p.conns[addr])+p.dialing[addr] >= p.maxConns
+		if cc != nil && (room > 0 || atMax && p.dialing[addr] == 0) {
+			if cc.ReserveNewRequest() {
+				if t, ok := req.Context().Value(requestTimerKey{}).(*requestTimer); ok {
+					t.setStreams(streams + 1)
+				}
+				return cc, nil
+			}
+			// can't take new streams although it isn't closing, e.g. stream ids ran out, so it's drained and closed
+			if state := cc.State(); !state.Closed && !state.Closing {
+				go func() { _ = cc.Shutdown(context.Background()) }()
+			}
+			p.remove(addr, cc)
+			continue
+		}
+		// connections being dialed take the requests they have room for, rather than each request dialing its own
+		if atMax || p.waiting[addr] < p.dialing[addr]*p.maxStreams {
+			if err := p.waitDialed(req.Context(), addr); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		p.dialing[addr]++
+		p.mx.Unlock()
+		cc, err := p.connect(req, addr)
+		p.mx.Lock()
+		p.dialing[addr]--
+		close(p.dialed)
+		p.dialed = make(chan struct{})
+		if err != nil {
+			return nil, err
+		}
+		p.conns[addr] = append(p.conns[addr], cc)
+	}
+}
+
+// waitDialed waits for the next dial to end, or for ctx to be done. It's called and returns with mx locked.
+func (p *http2Pool) waitDialed(ctx context.Context, addr string) error {
+	dialed := p.dialed
+	p.waiting[addr]++
+	p.mx.Unlock()
+	var err error
+	select {
+	case <-dialed:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	p.mx.Lock()
+	p.waiting[addr]--
+	return err
+}
+
+// leastLoaded picks the connection with the most room for streams, which is bounded by maxStreams and
+// by the limit of the server, dropping closed ones on the way.
+func (p *http2Pool) leastLoaded(addr string) (least *http2.ClientConn, streams int, room int) {
+	for _, cc := range append([]*http2.ClientConn(nil), p.conns[addr]...) {
+		state := cc.State()
+		if state.Closed || state.Closing {
+			p.remove(addr, cc)
+			continue
+		}
+		limit := p.maxStreams
+		// zero until the server's settings arrive
+		if m := int(state.MaxConcurrentStreams); m > 0 && m < limit {
+			limit = m
+		}
+		s := state.StreamsActive + state.StreamsReserved + state.StreamsPending
+		if least == nil || limit-s > room {
+			least, streams, room = cc, s, limit-s
+		}
+	}
+	return least, streams, room
+}
+
+func (p *http2Pool) MarkDead(cc *http2.ClientConn) {
+	p.mx.Lock()
+	defer p.mx.Unlock()
+	for addr := range p.conns {
+		p.remove(addr, cc)
+	}
+}
+
+func (p *http2Pool) remove(addr string, cc *http2.ClientConn) {
+	conns := p.conns[addr]
+	for i := range conns {
+		if conns[i] == cc {
+			p.conns[addr] = append(conns[:i:i], conns[i+1:]...)
+			return
+		}
+	}
+}
+
+func (p *http2Pool) closeIdle() {
+	p.mx.Lock()
+	defer p.mx.Unlock()
+	for addr, conns := range p.conns {
+		for _, cc := range conns {
+			if state := cc.State(); state.StreamsActive+state.StreamsReserved+state.StreamsPending == 0 {
+				_ = cc.Close()
+				p.remove(addr, cc)
+			}
+		}
+	}
+}
+
+// connect dials addr, negotiating h2 via ALPN for https. Dialing with the request context keeps its trace,
+// so the connection shows up in phases of the request which opened it.
+func (p *http2Pool) connect(req *http.Request, addr string) (*http2.ClientConn, error) {
+	https := req.URL.Scheme == "https"
+	if p.protocol == ProtocolH2C && https {
+		return nil, errors.New("h2c is cleartext, use an http URL or the http2 protocol")
+	}
+	if p.protocol == ProtocolHTTP2 && !https {
+		return nil, errors.New("http2 requires an https URL, use the h2c protocol for cleartext")
+	}
+
+	ctx := req.Context()
+	conn, err := p.dial(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if https {
+		if conn, err = p.handshake(ctx, conn, addr); err != nil {
+			return nil, err
+		}
+	}
+	cc, err := p.transport.NewClientConn(conn)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return cc, nil
+}
+
+func (p *http2Pool) handshake(ctx context.Context, conn net.Conn, addr string) (net.Conn, error) {
+	config := &tls.Config{}
+	if p.tls != nil {
+		config = p.tls.Clone()
+	}
+	config.NextProtos = []string{http2.NextProtoTLS}
+	if config.ServerName == "" {
+		config.ServerName, _, _ = net.SplitHostPort(addr)
+	}
+	if p.tlsTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.tlsTimeout)
+		defer cancel()
+	}
+
+	trace := httptrace.ContextClientTrace(ctx)
+	if trace != nil && trace.TLSHandshakeStart != nil {
+		trace.TLSHandshakeStart()
+	}
+	tlsConn := tls.Client(conn, config)
+	err := tlsConn.HandshakeContext(ctx)
+	if trace != nil && trace.TLSHandshakeDone != nil {
+		trace.TLSHandshakeDone(tlsConn.ConnectionState(), err)
+	}
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	if proto := tlsConn.ConnectionState().NegotiatedProtocol; proto != http2.NextProtoTLS {
+		_ = conn.Close()
+		return nil, fmt.Errorf("server negotiated [%v] instead of h2", proto)
+	}
+	return tlsConn, nil
+}
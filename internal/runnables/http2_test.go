@@ -0,0 +1,242 @@
+package runnables
+
+import (
+	"context"
+	"errors"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// blockingServer serves cleartext HTTP/2, holding every request until release is closed.
+type blockingServer struct {
+	*httptest.Server
+	release  chan struct{}
+	inFlight *atomic.Int32
+	maxSeen  *atomic.Int32
+	conns    *atomic.Int32
+}
+
+func newBlockingServer(t *testing.T, h2 *http2.Server) *blockingServer {
+	s := &blockingServer{release: make(chan struct{}), inFlight: &atomic.Int32{}, maxSeen: &atomic.Int32{}, conns: &atomic.Int32{}}
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := s.inFlight.Add(1)
+		defer s.inFlight.Add(-1)
+		for seen := s.maxSeen.Load(); n > seen && !s.maxSeen.CompareAndSwap(seen, n); seen = s.maxSeen.Load() {
+		}
+		<-s.release
+	})
+	s.Server = httptest.NewUnstartedServer(h2c.NewHandler(handler, h2))
+	s.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			s.conns.Add(1)
+		}
+	}
+	s.Start()
+	t.Cleanup(func() {
+		s.unblock()
+		s.Close()
+	})
+	return s
+}
+
+func (s *blockingServer) unblock() {
+	select {
+	case <-s.release:
+	default:
+		close(s.release)
+	}
+}
+
+// waitInFlight waits until the server holds n requests.
+func (s *blockingServer) waitInFlight(t *testing.T, n int32) {
+	deadline := time.Now().Add(5 * time.Second)
+	for s.inFlight.Load() < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("%v requests in flight, want %v", s.inFlight.Load(), n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestHttp2PoolConnectionCap(t *testing.T) {
+	srv := newBlockingServer(t, &http2.Server{})
+	client := HttpClientConfig{Protocol: ProtocolH2C, MaxConnsPerHost: 2, MaxConcurrentStreams: 1}.newClient(nil, nil)
+
+	const requests = 6
+	wg := &sync.WaitGroup{}
+	wg.Add(requests)
+	for i := 0; i < requests; i++ {
+		go func() {
+			defer wg.Done()
+			res, err := client.Get(srv.URL)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			_ = res.Body.Close()
+		}()
+	}
+	// streams pile onto full connections once the cap is reached
+	srv.waitInFlight(t, requests)
+	srv.unblock()
+	wg.Wait()
+
+	if conns := srv.conns.Load(); conns != 2 {
+		t.Errorf("opened %v connections, want 2", conns)
+	}
+}
+
+func TestHttp2PoolServerStreamLimit(t *testing.T) {
+	srv := newBlockingServer(t, &http2.Server{MaxConcurrentStreams: 1})
+	client := HttpClientConfig{Protocol: ProtocolH2C, MaxConnsPerHost: 2, MaxConcurrentStreams: 4}.newClient(nil, nil)
+
+	const requests = 6
+	wg := &sync.WaitGroup{}
+	wg.Add(requests)
+	get := func() {
+		defer wg.Done()
+		res, err := client.Get(srv.URL)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		_ = res.Body.Close()
+	}
+	// the first request gets the settings of the server in before the others pick connections
+	go get()
+	srv.waitInFlight(t, 1)
+	for i := 1; i < requests; i++ {
+		go get()
+	}
+	srv.waitInFlight(t, 2)
+	time.Sleep(50 * time.Millisecond)
+	if conns := srv.conns.Load(); conns != 2 {
+		t.Errorf("opened %v connections, want 2", conns)
+	}
+	srv.unblock()
+	wg.Wait()
+
+	if seen := srv.maxSeen.Load(); seen != 2 {
+		t.Errorf("%v requests in flight at most, want 2", seen)
+	}
+	if conns := srv.conns.Load(); conns != 2 {
+		t.Errorf("opened %v connections, want 2", conns)
+	}
+}
+
+func TestHttpClientsStreamCap(t *testing.T) {
+	srv := newBlockingServer(t, &http2.Server{})
+	clients := newHttpClients(HttpClientConfig{Protocol: ProtocolH2C, MaxConnsPerHost: 1, MaxConcurrentStreams: 2})
+
+	const requests = 6
+	wg := &sync.WaitGroup{}
+	wg.Add(requests)
+	for i := 0; i < requests; i++ {
+		go func() {
+			defer wg.Done()
+			client, err := clients.get(context.Background())
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer clients.release(client)
+			res, err := client.Get(srv.URL)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			_ = res.Body.Close()
+		}()
+	}
+	srv.waitInFlight(t, 2)
+	// give requests beyond the cap a chance to show up
+	time.Sleep(50 * time.Millisecond)
+	srv.unblock()
+	wg.Wait()
+
+	if seen := srv.maxSeen.Load(); seen != 2 {
+		t.Errorf("%v requests in flight at most, want 2", seen)
+	}
+	if conns := srv.conns.Load(); conns != 1 {
+		t.Errorf("opened %v connections, want 1", conns)
+	}
+}
+
+func TestHttp2PoolWaitCanceled(t *testing.T) {
+	srv := newBlockingServer(t, &http2.Server{})
+	dialing, dialed := make(chan struct{}), make(chan struct{})
+	var once sync.Once
+	dial := func(ctx context.Context, network, addr string) (net.Conn, error) {
+		once.Do(func() { close(dialing) })
+		<-dialed
+		return (&net.Dialer{}).DialContext(ctx, network, addr)
+	}
+	client := &http.Client{Transport: HttpClientConfig{Protocol: ProtocolH2C, MaxConnsPerHost: 1}.newHttp2Transport(dial, nil)}
+
+	first := make(chan error, 1)
+	go func() {
+		res, err := client.Get(srv.URL)
+		if err == nil {
+			_ = res.Body.Close()
+		}
+		first <- err
+	}()
+	<-dialing
+
+	// the connection cap is reached while the first request dials, so the second one waits for the dial
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+	start := time.Now()
+	_, err := client.Do(req)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("waiting for the dial failed with %v, want deadline exceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("waited %v for the dial", elapsed)
+	}
+
+	// the client timeout bounds the wait as well
+	client.Timeout = 50 * time.Millisecond
+	start = time.Now()
+	var netErr net.Error
+	if _, err = client.Get(srv.URL); !errors.As(err, &netErr) || !netErr.Timeout() {
+		t.Errorf("waiting for the dial failed with %v, want a timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("waited %v for the dial", elapsed)
+	}
+
+	close(dialed)
+	srv.unblock()
+	if err := <-first; err != nil {
+		t.Errorf("first request failed: %v", err)
+	}
+}
+
+func TestHttpClientsStreamWaitCanceled(t *testing.T) {
+	clients := newHttpClients(HttpClientConfig{Protocol: ProtocolH2C, MaxConnsPerHost: 1, MaxConcurrentStreams: 1})
+	held, err := clients.get(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer clients.release(held)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	if _, err := clients.get(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("waiting for a stream failed with %v, want canceled", err)
+	}
+
+	clients.config.Timeout = 20 * time.Millisecond
+	if _, err := clients.get(context.Background()); ClassifyError(err, ReasonHttpError) != ReasonClientTimeout {
+		t.Errorf("waiting for a stream failed with %v, want a client timeout", err)
+	}
+}
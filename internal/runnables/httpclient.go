@@ -0,0 +1,266 @@
+package runnables
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const defaultMaxConns = 1000
+
+// HttpClientConfig tunes the client of HTTP runnables, zero values keep the defaults.
+type HttpClientConfig struct {
+	// Timeout bounds the whole request including reading the body, 30s for HttpRunnableWithSupplier and 5s for HttpRunnable
+	Timeout               time.Duration
+	ConnectTimeout        time.Duration
+	TLSHandshakeTimeout   time.Duration
+	ResponseHeaderTimeout time.Duration
+	// DisableKeepAlives closes connections after every response instead of pooling them
+	DisableKeepAlives bool
+	// TCPKeepAlive is the interval of TCP keep-alive probes, negative disables them
+	TCPKeepAlive        time.Duration
+	MaxConnsPerHost     int // 1000 by default
+	MaxIdleConnsPerHost int // 1000 by default
+	// NewClientPerRequest sends every request with a fresh client, nothing is shared between requests,
+	// so each of them behaves like a distinct client rather than one pooled client
+	NewClientPerRequest bool
+	// DNSCacheTTL reuses resolved addresses for the TTL, hosts are resolved on every dial if zero
+	DNSCacheTTL time.Duration
+	// LocalAddr is the source IP connections are bound to
+	LocalAddr string
+	// Proxy is the URL of a proxy, "env" picks it from HTTP_PROXY, HTTPS_PROXY and NO_PROXY
+	Proxy string
+	TLS   TLSConfig
+	// Protocol is ProtocolHTTP1, ProtocolHTTP2 or ProtocolH2C. By default https URLs negotiate HTTP/2 or HTTP/1.1
+	// via ALPN over a pool of connections, like the standard client does, while http URLs speak HTTP/1.1
+	Protocol string
+	// MaxConcurrentStreams bounds streams per HTTP/2 connection, 100 by default. Another connection is opened
+	// once every connection is full, up to MaxConnsPerHost, then requests wait for a free stream.
+	MaxConcurrentStreams int
+}
+
+// Validate reports config which can't be used to build a client.
+func (c HttpClientConfig) Validate() error {
+	if c.LocalAddr != "" && net.ParseIP(c.LocalAddr) == nil {
+		return fmt.Errorf("local address [%v] isn't an IP", c.LocalAddr)
+	}
+	if c.Proxy != "" && c.Proxy != "env" {
+		u, err := url.Parse(c.Proxy)
+		if err != nil {
+			return fmt.Errorf("proxy: %w", err)
+		}
+		if u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("proxy [%v] should be a URL like http://host:port", c.Proxy)
+		}
+	}
+	if c.Timeout < 0 || c.ConnectTimeout < 0 || c.TLSHandshakeTimeout < 0 || c.ResponseHeaderTimeout < 0 || c.DNSCacheTTL < 0 {
+		return errors.New("timeouts and DNS cache TTL can't be negative")
+	}
+	if c.MaxConnsPerHost < 0 || c.MaxIdleConnsPerHost < 0 {
+		return errors.New("max connections can't be negative")
+	}
+	if _, err := c.TLS.build(); err != nil {
+		return fmt.Errorf("tls: %w", err)
+	}
+	switch c.Protocol {
+	case "", ProtocolHTTP1:
+		if c.MaxConcurrentStreams != 0 {
+			return errors.New("max concurrent streams apply to HTTP/2 only")
+		}
+	case ProtocolHTTP2, ProtocolH2C:
+		if c.Proxy != "" || c.DisableKeepAlives || c.ResponseHeaderTimeout != 0 || c.MaxIdleConnsPerHost != 0 {
+			return errors.New("proxy, disabled keep-alives, response header timeout and max idle conns apply to HTTP/1.1 only")
+		}
+		if c.MaxConcurrentStreams < 0 {
+			return errors.New("max concurrent streams can't be negative")
+		}
+	default:
+		return fmt.Errorf("unknown protocol [%v], expected %v, %v or %v", c.Protocol, ProtocolHTTP1, ProtocolHTTP2, ProtocolH2C)
+	}
+	return nil
+}
+
+// withDefaultTimeout keeps timeout unless the config sets its own.
+func (c HttpClientConfig) withDefaultTimeout(timeout time.Duration) HttpClientConfig {
+	if c.Timeout == 0 {
+		c.Timeout = timeout
+	}
+	return c
+}
+
+func (c HttpClientConfig) newClient(dns *dnsCache, tlsConfig *tls.Config) *http.Client {
+	dialer := &net.Dialer{Timeout: c.ConnectTimeout, KeepAlive: c.TCPKeepAlive}
+	if c.LocalAddr != "" {
+		dialer.LocalAddr = &net.TCPAddr{IP: net.ParseIP(c.LocalAddr)}
+	}
+	dial := dialer.DialContext
+	if dns != nil {
+		dial = dns.dialer(dialer)
+	}
+	if multiplexed(c.Protocol) {
+		return &http.Client{Transport: c.newHttp2Transport(dial, tlsConfig), Timeout: c.Timeout}
+	}
+	transport := &http.Transport{
+		DialContext:           dial,
+		MaxIdleConns:          defaultMaxConns,
+		MaxConnsPerHost:       orDefault(c.MaxConnsPerHost, defaultMaxConns),
+		MaxIdleConnsPerHost:   orDefault(c.MaxIdleConnsPerHost, defaultMaxConns),
+		DisableKeepAlives:     c.DisableKeepAlives,
+		TLSHandshakeTimeout:   c.TLSHandshakeTimeout,
+		ResponseHeaderTimeout: c.ResponseHeaderTimeout,
+		TLSClientConfig:       tlsConfig,
+		// a custom dialer or TLS config turns HTTP/2 off unless forced, only ProtocolHTTP1 asks for that
+		ForceAttemptHTTP2: c.Protocol == "",
+	}
+	switch c.Proxy {
+	case "":
+	case "env":
+		transport.Proxy = http.ProxyFromEnvironment
+	default:
+		proxy, _ := url.Parse(c.Proxy)
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+	return &http.Client{Transport: transport, Timeout: c.Timeout}
+}
+
+func orDefault(v, def int) int {
+	if v == 0 {
+		return def
+	}
+	return v
+}
+
+// httpClients hands out the shared client, or a fresh one per request when the config asks for distinct clients.
+// The DNS cache is shared either way, so distinct clients don't hammer the resolver unless asked to.
+type httpClients struct {
+	config HttpClientConfig
+	dns    *dnsCache
+	tls    *tls.Config // loaded once, so distinct clients don't read certificates on every request
+	shared *http.Client
+	// streams bounds HTTP/2 requests in flight to connections times their streams, nil for HTTP/1.1
+	streams chan struct{}
+}
+
+// newHttpClients expects a validated config.
+func newHttpClients(config HttpClientConfig) *httpClients {
+	tlsConfig, err := config.TLS.build()
+	if err != nil {
+		panic(fmt.Sprintf("invalid tls config: %v", err))
+	}
+	c := &httpClients{config: config, tls: tlsConfig}
+	if config.DNSCacheTTL > 0 {
+		c.dns = newDNSCache(config.DNSCacheTTL)
+	}
+	if !config.NewClientPerRequest {
+		c.shared = config.newClient(c.dns, c.tls)
+	}
+	if multiplexed(config.Protocol) {
+		c.streams = make(chan struct{}, orDefault(config.MaxConnsPerHost, defaultMaxConns)*orDefault(config.MaxConcurrentStreams, defaultMaxConcurrentStreams))
+	}
+	return c
+}
+
+// errStreamWait is reported when no stream frees up within the client timeout.
+var errStreamWait = errors.New("Client.Timeout exceeded while waiting for a free stream")
+
+// get waits for a free stream when multiplexing, so the wait counts towards latency like any client-side queueing.
+// The wait ends with ctx, or with the client timeout, which would have bounded the request had it been sent.
+func (c *httpClients) get(ctx context.Context) (*http.Client, error) {
+	if c.streams != nil {
+		select {
+		case c.streams <- struct{}{}:
+		default:
+			var timeout <-chan time.Time
+			if c.config.Timeout > 0 {
+				t := time.NewTimer(c.config.Timeout)
+				defer t.Stop()
+				timeout = t.C
+			}
+			select {
+			case c.streams <- struct{}{}:
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-timeout:
+				return nil, errStreamWait
+			}
+		}
+	}
+	if c.shared != nil {
+		return c.shared, nil
+	}
+	return c.config.newClient(c.dns, c.tls), nil
+}
+
+// release frees the stream and closes connections of a client which was created for a single request.
+func (c *httpClients) release(client *http.Client) {
+	if client != c.shared {
+		client.CloseIdleConnections()
+	}
+	if c.streams != nil {
+		<-c.streams
+	}
+}
+
+// dnsCache resolves each host once per TTL and spreads dials over its addresses.
+type dnsCache struct {
+	ttl     time.Duration
+	entries map[string]*dnsEntry
+	mx      *sync.Mutex
+}
+
+type dnsEntry struct {
+	addrs   []string
+	expires time.Time
+	next    int
+}
+
+func newDNSCache(ttl time.Duration) *dnsCache {
+	return &dnsCache{ttl: ttl, entries: make(map[string]*dnsEntry), mx: &sync.Mutex{}}
+}
+
+func (d *dnsCache) dialer(dialer *net.Dialer) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil || net.ParseIP(host) != nil {
+			return dialer.DialContext(ctx, network, addr)
+		}
+		ips, err := d.resolve(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		var conn net.Conn
+		for _, ip := range ips {
+			if conn, err = dialer.DialContext(ctx, network, net.JoinHostPort(ip, port)); err == nil {
+				return conn, nil
+			}
+		}
+		return nil, err
+	}
+}
+
+// resolve returns addresses of host, rotated so consecutive dials start with a different one.
+func (d *dnsCache) resolve(ctx context.Context, host string) ([]string, error) {
+	d.mx.Lock()
+	entry, ok := d.entries[host]
+	if !ok || time.Now().After(entry.expires) {
+		d.mx.Unlock()
+		addrs, err := net.DefaultResolver.LookupHost(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		d.mx.Lock()
+		entry = &dnsEntry{addrs: addrs, expires: time.Now().Add(d.ttl)}
+		d.entries[host] = entry
+	}
+	defer d.mx.Unlock()
+
+	start := entry.next % len(entry.addrs)
+	entry.next++
+	return append(append([]string(nil), entry.addrs[start:]...), entry.addrs[:start]...), nil
+}
@@ -0,0 +1,106 @@
+package runnables
+
+import (
+	"aggressive-pokes/internal/stats"
+	"context"
+	"crypto/tls"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// Phases of an HTTP request, reported in this order. Phases which didn't happen, e.g. dns and connect
+// on a reused connection, are left out.
+const (
+	PhaseDNS      = "dns"      // resolving the host
+	PhaseConnect  = "connect"  // establishing the TCP connection
+	PhaseTLS      = "tls"      // TLS handshake
+	PhaseTTFB     = "ttfb"     // from the request being written to the first response byte, i.e. waiting for the service
+	PhaseTransfer = "transfer" // from the first response byte to the body being read
+)
+
+// requestTimer collects timestamps of a single request via httptrace.
+// Hooks may be called from other goroutines, e.g. when dialing several addresses at once.
+type requestTimer struct {
+	mx           *sync.Mutex
+	dnsStart     time.Time
+	dnsDone      time.Time
+	connectStart time.Time
+	connectDone  time.Time
+	tlsStart     time.Time
+	tlsDone      time.Time
+	wroteRequest time.Time
+	firstByte    time.Time
+	gotConn      bool
+	reused       bool
+	streams      int // set by the HTTP/2 pool when the request was multiplexed
+}
+
+// requestTimerKey holds the timer in the request context, so the HTTP/2 pool can report streams.
+type requestTimerKey struct{}
+
+func newRequestTimer() *requestTimer {
+	return &requestTimer{mx: &sync.Mutex{}}
+}
+
+// trace attaches the timer to the request.
+func (t *requestTimer) trace(req *http.Request) *http.Request {
+	ctx := context.WithValue(req.Context(), requestTimerKey{}, t)
+	return req.WithContext(httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) { t.set(&t.dnsStart) },
+		DNSDone:  func(httptrace.DNSDoneInfo) { t.set(&t.dnsDone) },
+		// the first dial to start and the last one to finish bound the connect phase
+		ConnectStart: func(string, string) {
+			t.mx.Lock()
+			defer t.mx.Unlock()
+			if t.connectStart.IsZero() {
+				t.connectStart = time.Now()
+			}
+		},
+		ConnectDone:       func(string, string, error) { t.set(&t.connectDone) },
+		TLSHandshakeStart: func() { t.set(&t.tlsStart) },
+		TLSHandshakeDone:  func(tls.ConnectionState, error) { t.set(&t.tlsDone) },
+		GotConn: func(info httptrace.GotConnInfo) {
+			t.mx.Lock()
+			defer t.mx.Unlock()
+			t.gotConn, t.reused = true, info.Reused
+		},
+		WroteRequest:         func(httptrace.WroteRequestInfo) { t.set(&t.wroteRequest) },
+		GotFirstResponseByte: func() { t.set(&t.firstByte) },
+	}))
+}
+
+func (t *requestTimer) setStreams(streams int) {
+	t.mx.Lock()
+	defer t.mx.Unlock()
+	t.streams = streams
+}
+
+func (t *requestTimer) set(at *time.Time) {
+	t.mx.Lock()
+	defer t.mx.Unlock()
+	*at = time.Now()
+}
+
+// execution builds the report of the request finished at end, with phases which have both boundaries.
+func (t *requestTimer) execution(reason string, start, end time.Time) stats.Execution {
+	t.mx.Lock()
+	defer t.mx.Unlock()
+
+	e := stats.Execution{Time: end, Reason: reason, Elapsed: end.Sub(start), Reused: t.reused}
+	e.NewConnection, e.Streams = t.gotConn && !t.reused, t.streams
+	e.Phases = appendPhase(e.Phases, PhaseDNS, t.dnsStart, t.dnsDone)
+	e.Phases = appendPhase(e.Phases, PhaseConnect, t.connectStart, t.connectDone)
+	e.Phases = appendPhase(e.Phases, PhaseTLS, t.tlsStart, t.tlsDone)
+	e.Phases = appendPhase(e.Phases, PhaseTTFB, t.wroteRequest, t.firstByte)
+	e.Phases = appendPhase(e.Phases, PhaseTransfer, t.firstByte, end)
+	return e
+}
+
+func appendPhase(phases []stats.Phase, name string, start, end time.Time) []stats.Phase {
+	if start.IsZero() || end.IsZero() || end.Before(start) {
+		return phases
+	}
+	return append(phases, stats.Phase{Name: name, Elapsed: end.Sub(start)})
+}
@@ -6,32 +6,82 @@ import (
 	"aggressive-pokes/internal/utils"
 	"cloud.google.com/go/pubsub"
 	"context"
+	"fmt"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"strings"
 	"time"
+	"unicode"
 )
 
-func PubsubRunnable(logger ltlogger.Logger, projectId, topicName string, body []byte) func(reporter stats.Reporter) {
+// PubsubRunnable publishes body to the topic, creating it if it doesn't exist yet.
+func PubsubRunnable(logger ltlogger.Logger, projectId, topicName string, body []byte) (func(reporter stats.Reporter), error) {
 	pbClient, err := pubsub.NewClient(context.Background(), projectId)
 	if err != nil {
-		logger.Fatal("Cannot create pubsub client", "err", err)
+		return nil, fmt.Errorf("pubsub client: %w", err)
 	}
-	topic := utils.GetPubsubTopic(logger, pbClient, topicName)
+	topic, err := utils.GetPubsubTopic(logger, pbClient, topicName)
+	if err != nil {
+		_ = pbClient.Close()
+		return nil, err
+	}
+	tags := stats.Tags{"topic": topicName}
 	return func(reporter stats.Reporter) {
+		reporter = reporter.WithTags(tags)
 		start := time.Now()
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
 
-		result := topic.Publish(ctx, &pubsub.Message{
+		msg := &pubsub.Message{
 			Data:       body,
 			Attributes: map[string]string{"serverTime": time.Now().Format(time.RFC3339)},
-		})
+		}
+		result := topic.Publish(ctx, msg)
 
 		<-result.Ready()
-		_, err := result.Get(context.Background())
+		id, err := result.Get(context.Background())
+		e := stats.Execution{Reason: "pubsub_publish_success", Elapsed: time.Since(start), Sent: messageSize(msg)}
 		if err != nil {
-			reporter.ReportFailure("pubsub_publish_error", err.Error(), time.Since(start))
-			return
+			e.Reason, e.Message, e.Failed = classifyPubsubError(err), err.Error(), true
+		} else {
+			e.Received = stats.Size{Body: int64(len(id)), Decoded: int64(len(id))}
 		}
-		reporter.Report("pubsub_publish_success", time.Since(start))
+		reporter.ReportExecution(e)
+	}, nil
+}
+
+// messageSize counts attributes as headers, the protocol overhead of the publish call is left out.
+func messageSize(msg *pubsub.Message) stats.Size {
+	size := stats.Size{Body: int64(len(msg.Data)), Decoded: int64(len(msg.Data))}
+	for k, v := range msg.Attributes {
+		size.Headers += int64(len(k) + len(v))
 	}
+	return size
+}
 
+// classifyPubsubError names the reason after the gRPC status code, e.g. pubsub_deadline_exceeded,
+// falling back to transport errors and pubsub_publish_error.
+func classifyPubsubError(err error) string {
+	if s, ok := status.FromError(err); ok && s.Code() != codes.Unknown {
+		return "pubsub_" + snakeCase(s.Code().String())
+	}
+	return ClassifyError(err, "pubsub_publish_error")
+}
+
+// snakeCase splits words at capitals, a run of capitals is one word, e.g. OK is ok and DeadlineExceeded is deadline_exceeded.
+func snakeCase(s string) string {
+	var b strings.Builder
+	var prev rune
+	for _, r := range s {
+		if unicode.IsUpper(r) {
+			if prev != 0 && !unicode.IsUpper(prev) {
+				b.WriteByte('_')
+			}
+			b.WriteRune(unicode.ToLower(r))
+		} else {
+			b.WriteRune(r)
+		}
+		prev = r
+	}
+	return b.String()
 }
@@ -33,7 +33,7 @@ func NewHttpRequestSupplier(logger ltlogger.Logger, method, url string, body []b
 }
 
 func (s *HttpRequestSupplier) request() (*http.Request, error) {
-	req, err := http.NewRequest(http.MethodPost, s.url, bytes.NewReader(s.payloadMutator(s.body)))
+	req, err := http.NewRequest(s.method, s.url, bytes.NewReader(s.payloadMutator(s.body)))
 	if s.headers != nil {
 		for k, v := range s.headers {
 			req.Header.Set(k, v)
@@ -0,0 +1,286 @@
+package runnables
+
+import (
+	"aggressive-pokes/internal/capture"
+	"aggressive-pokes/internal/stats"
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"regexp"
+	"sync/atomic"
+	"time"
+)
+
+// Reasons of streamed responses, responses other than 2xx are reported by their status code like other HTTP runnables.
+const (
+	ReasonStreamCompleted         = "stream_completed"           // the server ended the stream or an event matched Until
+	ReasonStreamHeld              = "stream_held"                // the stream stayed open for MaxDuration or until the stage stopped
+	ReasonStreamDisconnected      = "stream_disconnected"        // the stream broke, or ended although it should be endless
+	ReasonStreamFirstEventTimeout = "stream_first_event_timeout" // no event arrived within FirstEventTimeout
+)
+
+// PhaseFirstEvent is the wait for the first event since the request started.
+const PhaseFirstEvent = "first_event"
+
+// Formats of streamed responses.
+const (
+	StreamFormatSSE   = "sse"   // server-sent events, an event ends with a blank line and comments are skipped
+	StreamFormatLines = "lines" // every non-empty line is an event, e.g. JSON lines
+)
+
+// StreamConfig tells how to read a streamed response and when to stop.
+type StreamConfig struct {
+	// Format is sse or lines, empty picks sse for text/event-stream responses and lines otherwise
+	Format string
+	// Until ends the stream once an event matches, e.g. \[DONE\], data of server-sent events is matched
+	Until string
+	// MaxDuration closes the stream once it's been open that long since the request started, unlimited if zero
+	MaxDuration time.Duration
+	// FirstEventTimeout bounds the wait for the first event, unlimited if zero
+	FirstEventTimeout time.Duration
+	// Endless treats the server ending the stream as a disconnect, e.g. for live feeds
+	Endless bool
+}
+
+// Validate reports invalid config.
+func (c StreamConfig) Validate() error {
+	switch c.Format {
+	case "", StreamFormatSSE, StreamFormatLines:
+	default:
+		return fmt.Errorf("stream format [%v] should be sse or lines", c.Format)
+	}
+	if _, err := regexp.Compile(c.Until); err != nil {
+		return fmt.Errorf("until: %w", err)
+	}
+	if c.Endless && c.MaxDuration == 0 {
+		return errors.New("endless streams require max duration")
+	}
+	return nil
+}
+
+var (
+	errStreamHeld        = errors.New("stream held for max duration")
+	errFirstEventTimeout = errors.New("no event arrived in time")
+	errStreamRead        = errors.New("stream read")
+)
+
+// StreamRunnable reads events of a response kept open, invalid config panics.
+func StreamRunnable(supplier *HttpRequestSupplier, config StreamConfig, opts ...HttpOption) func(reporter stats.Reporter) {
+	if err := config.Validate(); err != nil {
+		panic(fmt.Sprintf("invalid stream config: %v", err))
+	}
+	options := newHttpOptions(opts)
+	if err := options.client.Validate(); err != nil {
+		panic(fmt.Sprintf("invalid http client config: %v", err))
+	}
+	clients := newHttpClients(options.client)
+	var until *regexp.Regexp
+	if config.Until != "" {
+		until = regexp.MustCompile(config.Until)
+	}
+
+	supplier.logger.Info("Initialized stream client", "url", supplier.url, "format", config.Format,
+		"maxDuration", config.MaxDuration, "firstEventTimeout", config.FirstEventTimeout)
+
+	return func(reporter stats.Reporter) {
+		start := time.Now()
+		req, err := supplier.request()
+		if err != nil {
+			reporter.ReportFailure(ReasonRequestSetup, err.Error(), time.Since(start))
+			return
+		}
+		reporter = reporter.WithTags(options.tags(req))
+		if config.Format == StreamFormatSSE && req.Header.Get("Accept") == "" {
+			req.Header.Set("Accept", "text/event-stream")
+		}
+		// compressed events would wait in buffers of the decoder
+		if req.Header.Get("Accept-Encoding") == "" {
+			req.Header.Set("Accept-Encoding", "identity")
+		}
+
+		ctx, cancel := context.WithCancelCause(reporter.Context())
+		defer cancel(nil)
+		if config.MaxDuration > 0 {
+			held := time.AfterFunc(config.MaxDuration, func() { cancel(errStreamHeld) })
+			defer held.Stop()
+		}
+		s := &stream{until: until, gaps: stats.NewHistogram(), firstEvent: &atomic.Bool{}}
+		if config.FirstEventTimeout > 0 {
+			s.firstEventTimer = time.AfterFunc(config.FirstEventTimeout, func() {
+				if s.firstEvent.CompareAndSwap(false, true) {
+					cancel(errFirstEventTimeout)
+				}
+			})
+			defer s.firstEventTimer.Stop()
+		}
+
+		httpClient, err := clients.get(ctx)
+		if err != nil {
+			if stopped(ctx) {
+				return
+			}
+			reporter.ReportFailure(streamFailure(ctx, err, false), err.Error(), time.Since(start))
+			return
+		}
+		defer clients.release(httpClient)
+		x, err := send(httpClient, req.WithContext(ctx), reporter, start, options)
+		if err != nil {
+			if !stopped(ctx) {
+				x.fail(streamFailure(ctx, err, false), err)
+			}
+			return
+		}
+		res := x.res
+		if res.StatusCode/100 != 2 {
+			var body *capture.Body
+			if options.capture != nil && options.capture.ShouldCapture(true) {
+				body = options.capture.NewBody()
+			}
+			e, err := x.read(body)
+			if err != nil {
+				e.Reason = streamFailure(ctx, err, false)
+			}
+			x.report(e, body)
+			return
+		}
+
+		received := responseHeaderSize(res)
+		raw := &countingReader{r: res.Body}
+		err = s.read(raw, streamFormat(config.Format, res.Header.Get("Content-Type")))
+		// settles the cause, so timers firing or the stage stopping from now on don't change the reason
+		cancel(errStreamRead)
+		_ = res.Body.Close()
+		end := time.Now()
+		received.Body, received.Decoded = raw.n, raw.n
+
+		e := x.timer.execution(ReasonStreamCompleted, start, end)
+		e.Sent, e.Received, e.Protocol = x.sent, received, negotiatedProtocol(res)
+		e.Events = &stats.Events{Count: s.count, Gaps: s.gaps}
+		if s.count > 0 {
+			e.Phases = appendPhase(e.Phases, PhaseFirstEvent, start, s.first)
+		}
+		switch cause := context.Cause(ctx); {
+		case errors.Is(cause, errStreamHeld), stopped(ctx):
+			e.Reason = ReasonStreamHeld
+		case err == nil && config.Endless:
+			e.Reason, e.Failed, e.Message = ReasonStreamDisconnected, true, "stream ended"
+		case err != nil:
+			e.Reason, e.Failed, e.Message = streamFailure(ctx, err, true), true, err.Error()
+		}
+		reporter.ReportExecution(e)
+	}
+}
+
+// stream counts events of a response.
+type stream struct {
+	until           *regexp.Regexp
+	firstEventTimer *time.Timer
+	firstEvent      *atomic.Bool // claimed by the first event or by the timer, whichever comes first
+	count           int
+	first           time.Time
+	last            time.Time
+	gaps            *stats.Histogram
+}
+
+// read counts events until the body ends or one matches Until, nil means the stream ended cleanly.
+func (s *stream) read(body io.Reader, format string) error {
+	r := bufio.NewReader(body)
+	var (
+		data    bytes.Buffer
+		hasData bool // a data field of a server-sent event was read, events without one aren't dispatched
+	)
+	for {
+		line, err := r.ReadBytes('\n')
+		if err != nil && !(errors.Is(err, io.EOF) && len(line) > 0) {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		line = bytes.TrimRight(line, "\r\n")
+		switch {
+		case format == StreamFormatLines && len(line) > 0:
+			if s.event(line) {
+				return nil
+			}
+		case format == StreamFormatSSE && len(line) == 0:
+			if hasData && s.event(data.Bytes()) {
+				return nil
+			}
+			hasData = false
+			data.Reset()
+		case format == StreamFormatSSE && len(line) > 0 && line[0] != ':':
+			if value, ok := sseData(line); ok {
+				if hasData {
+					data.WriteByte('\n')
+				}
+				data.Write(value)
+				hasData = true
+			}
+		}
+		if err != nil {
+			return nil
+		}
+	}
+}
+
+// sseData returns the value of a data field, a field name without a colon has an empty value.
+func sseData(line []byte) ([]byte, bool) {
+	if string(line) == "data" {
+		return nil, true
+	}
+	value, ok := bytes.CutPrefix(line, []byte("data:"))
+	return bytes.TrimPrefix(value, []byte(" ")), ok
+}
+
+// event records an event with data, telling whether it ends the stream.
+func (s *stream) event(data []byte) bool {
+	now := time.Now()
+	if s.count == 0 {
+		s.first = now
+		// an event arriving after the timer fired is too late, the stream is being canceled
+		s.firstEvent.Store(true)
+	} else {
+		s.gaps.Record(now.Sub(s.last))
+	}
+	s.count++
+	s.last = now
+	return s.until != nil && s.until.Match(data)
+}
+
+// stopped tells whether the stage stopping canceled the stream rather than the runnable with a cause of its own.
+func stopped(ctx context.Context) bool {
+	switch cause := context.Cause(ctx); {
+	case cause == nil, errors.Is(cause, errStreamHeld), errors.Is(cause, errFirstEventTimeout), errors.Is(cause, errStreamRead):
+		return false
+	default:
+		return true
+	}
+}
+
+// streamFailure tells timeouts of the runnable apart from transport errors, streaming is set once the response arrived.
+func streamFailure(ctx context.Context, err error, streaming bool) string {
+	switch cause := context.Cause(ctx); {
+	case errors.Is(cause, errFirstEventTimeout), errors.Is(cause, errStreamHeld):
+		// held before the response arrived, so no event could arrive either
+		return ReasonStreamFirstEventTimeout
+	case streaming:
+		return ReasonStreamDisconnected
+	default:
+		return ClassifyError(err, ReasonHttpError)
+	}
+}
+
+func streamFormat(format, contentType string) string {
+	if format != "" {
+		return format
+	}
+	if mediaType, _, _ := mime.ParseMediaType(contentType); mediaType == "text/event-stream" {
+		return StreamFormatSSE
+	}
+	return StreamFormatLines
+}
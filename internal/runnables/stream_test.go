@@ -0,0 +1,209 @@
+package runnables
+
+import (
+	"aggressive-pokes/internal/ltlogger"
+	"aggressive-pokes/internal/stats"
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// recorder collects executions reported by a runnable.
+type recorder struct {
+	executions []stats.Execution
+	mx         *sync.Mutex
+}
+
+func newRecorder() (*recorder, stats.Reporter) {
+	r := &recorder{mx: &sync.Mutex{}}
+	return r, stats.NewReporter(stats.SinkFunc(func(e stats.Execution) {
+		r.mx.Lock()
+		defer r.mx.Unlock()
+		r.executions = append(r.executions, e)
+	}))
+}
+
+// single returns the only reported execution.
+func (r *recorder) single(t *testing.T) stats.Execution {
+	t.Helper()
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	if len(r.executions) != 1 {
+		t.Fatalf("reported %v executions, want 1", len(r.executions))
+	}
+	return r.executions[0]
+}
+
+func testLogger() ltlogger.Logger {
+	return ltlogger.New(false, "test", slog.LevelWarn)
+}
+
+func TestStreamReadSSE(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		until  string
+		events int
+	}{
+		{name: "events", body: "data: a\n\ndata: b\n\n", events: 2},
+		{name: "multi-line data", body: "data: a\ndata: b\n\n", events: 1},
+		{name: "crlf", body: "data: a\r\n\r\ndata: b\r\n\r\n", events: 2},
+		{name: "comments", body: ": ping\n\n: ping\n\ndata: a\n\n", events: 1},
+		{name: "fields without data", body: "event: ping\n\nid: 1\n\nretry: 10\n\n", events: 0},
+		{name: "data along with other fields", body: "event: update\nid: 2\ndata: a\n\n", events: 1},
+		{name: "empty data", body: "data\n\ndata:\n\n", events: 2},
+		{name: "unterminated event", body: "data: a\n\ndata: b", events: 1},
+		{name: "until", body: "data: a\n\ndata: [DONE]\n\ndata: b\n\n", until: `\[DONE\]`, events: 2},
+		{name: "until matches data only", body: "event: DONE\ndata: a\n\ndata: b\n\n", until: `DONE`, events: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &stream{gaps: stats.NewHistogram(), firstEvent: &atomic.Bool{}}
+			if tt.until != "" {
+				s.until = regexp.MustCompile(tt.until)
+			}
+			if err := s.read(strings.NewReader(tt.body), StreamFormatSSE); err != nil {
+				t.Fatal(err)
+			}
+			if s.count != tt.events {
+				t.Errorf("read %v events, want %v", s.count, tt.events)
+			}
+		})
+	}
+}
+
+func TestStreamReadLines(t *testing.T) {
+	s := &stream{gaps: stats.NewHistogram(), firstEvent: &atomic.Bool{}}
+	if err := s.read(strings.NewReader("{\"a\":1}\n\n{\"a\":2}\r\n{\"a\":3}"), StreamFormatLines); err != nil {
+		t.Fatal(err)
+	}
+	if s.count != 3 {
+		t.Errorf("read %v events, want 3", s.count)
+	}
+}
+
+// streamServer writes events, flushing each, then ends the stream unless hold is set, in which case it keeps it open.
+func streamServer(t *testing.T, events []string, hold bool) *httptest.Server {
+	done := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		for _, e := range events {
+			_, _ = fmt.Fprintf(w, "data: %v\n\n", e)
+			w.(http.Flusher).Flush()
+		}
+		if hold {
+			select {
+			case <-r.Context().Done():
+			case <-done:
+			}
+		}
+	}))
+	t.Cleanup(func() {
+		close(done)
+		srv.Close()
+	})
+	return srv
+}
+
+func runStream(t *testing.T, url string, config StreamConfig) stats.Execution {
+	rec, reporter := newRecorder()
+	supplier := NewHttpRequestSupplier(testLogger(), http.MethodGet, url, nil, nil, nil)
+	StreamRunnable(supplier, config)(reporter)
+	return rec.single(t)
+}
+
+func TestStreamRunnable(t *testing.T) {
+	tests := []struct {
+		name   string
+		events []string
+		hold   bool
+		config StreamConfig
+		reason string
+		failed bool
+		count  int
+	}{
+		{name: "completed", events: []string{"a", "b", "c"}, reason: ReasonStreamCompleted, count: 3},
+		{name: "until", events: []string{"a", "[DONE]"}, hold: true, config: StreamConfig{Until: `\[DONE\]`}, reason: ReasonStreamCompleted, count: 2},
+		{name: "held", events: []string{"a"}, hold: true, config: StreamConfig{MaxDuration: 100 * time.Millisecond}, reason: ReasonStreamHeld, count: 1},
+		{name: "first event timeout", hold: true, config: StreamConfig{FirstEventTimeout: 50 * time.Millisecond}, reason: ReasonStreamFirstEventTimeout, failed: true},
+		{name: "first event in time", events: []string{"a"}, config: StreamConfig{FirstEventTimeout: time.Second}, reason: ReasonStreamCompleted, count: 1},
+		{name: "endless stream ended", events: []string{"a"}, config: StreamConfig{Endless: true, MaxDuration: time.Second}, reason: ReasonStreamDisconnected, failed: true, count: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := streamServer(t, tt.events, tt.hold)
+			e := runStream(t, srv.URL, tt.config)
+			if e.Reason != tt.reason || e.Failed != tt.failed {
+				t.Errorf("reported %v failed %v, want %v failed %v", e.Reason, e.Failed, tt.reason, tt.failed)
+			}
+			if e.Events == nil || e.Events.Count != tt.count {
+				t.Errorf("reported events %+v, want %v", e.Events, tt.count)
+			}
+		})
+	}
+}
+
+func TestStreamDisconnected(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = fmt.Fprint(w, "data: a\n\n")
+		w.(http.Flusher).Flush()
+		panic(http.ErrAbortHandler)
+	}))
+	defer srv.Close()
+
+	e := runStream(t, srv.URL, StreamConfig{})
+	if e.Reason != ReasonStreamDisconnected || !e.Failed {
+		t.Errorf("reported %v failed %v, want %v", e.Reason, e.Failed, ReasonStreamDisconnected)
+	}
+}
+
+func TestStreamStatusFailure(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	e := runStream(t, srv.URL, StreamConfig{})
+	if e.Reason != "503" || !e.Failed {
+		t.Errorf("reported %v failed %v, want 503 failed", e.Reason, e.Failed)
+	}
+}
+
+func TestStreamStageStopped(t *testing.T) {
+	srv := streamServer(t, []string{"a"}, true)
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	rec, reporter := newRecorder()
+	StreamRunnable(NewHttpRequestSupplier(testLogger(), http.MethodGet, srv.URL, nil, nil, nil), StreamConfig{})(reporter.WithContext(ctx))
+	// streams open when the stage stops are held rather than failed
+	if e := rec.single(t); e.Reason != ReasonStreamHeld || e.Failed {
+		t.Errorf("reported %v failed %v, want %v", e.Reason, e.Failed, ReasonStreamHeld)
+	}
+}
+
+func TestStreamStoppedBeforeResponse(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	rec, reporter := newRecorder()
+	StreamRunnable(NewHttpRequestSupplier(testLogger(), http.MethodGet, srv.URL, nil, nil, nil), StreamConfig{})(reporter.WithContext(ctx))
+	if len(rec.executions) != 0 {
+		t.Errorf("reported %+v, want nothing once the stage stopped before the response", rec.executions)
+	}
+}
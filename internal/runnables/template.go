@@ -0,0 +1,64 @@
+package runnables
+
+import (
+	"bytes"
+	"github.com/google/uuid"
+	"math/rand"
+	"sync/atomic"
+	"text/template"
+	"time"
+)
+
+// Template renders a payload per execution, e.g. {"id": "{{ uuid }}", "n": {{ randInt 1 100 }}}.
+// Values are inserted as they are, so strings in JSON need their quotes in the template.
+type Template struct {
+	tmpl *template.Template
+	seq  *atomic.Int64
+}
+
+const randLetters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+// NewTemplate parses text and renders it once with sample data, like the data passed to Execute,
+// so templates failing on execution are rejected up front.
+func NewTemplate(text string, sample any) (*Template, error) {
+	t := &Template{seq: &atomic.Int64{}}
+	tmpl, err := template.New("payload").Option("missingkey=error").Funcs(template.FuncMap{
+		"uuid": func() string { return uuid.NewString() },
+		// seq counts executions of the template starting at 1
+		"seq":     func() int64 { return t.seq.Add(1) },
+		"randInt": func(min, max int) int { return min + rand.Intn(max-min+1) },
+		"randString": func(n int) string {
+			b := make([]byte, n)
+			for i := range b {
+				b[i] = randLetters[rand.Intn(len(randLetters))]
+			}
+			return string(b)
+		},
+		"randChoice": func(choices ...string) string { return choices[rand.Intn(len(choices))] },
+		"now":        func() string { return time.Now().Format(time.RFC3339Nano) },
+		"unixMillis": func() int64 { return time.Now().UnixMilli() },
+	}).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	t.tmpl = tmpl
+	if _, err := t.Execute(sample); err != nil {
+		return nil, err
+	}
+	t.reset()
+	return t, nil
+}
+
+// reset restarts seq, e.g. after checking a rendered payload up front.
+func (t *Template) reset() {
+	t.seq.Store(0)
+}
+
+// Execute renders the template, data is available as dot, e.g. {{ .user }}.
+func (t *Template) Execute(data any) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := t.tmpl.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
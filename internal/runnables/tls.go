@@ -0,0 +1,128 @@
+package runnables
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// TLSConfig configures TLS of HTTP runnables, the zero value verifies servers against the system roots.
+type TLSConfig struct {
+	// CAFile is a PEM bundle of CAs trusted on top of the system roots, e.g. to trust a self-signed cert
+	CAFile string
+	// CertFile and KeyFile are the PEM client certificate and its key presented for mTLS
+	CertFile string
+	KeyFile  string
+	// InsecureSkipVerify accepts any server certificate, meant for test environments only
+	InsecureSkipVerify bool
+	// ServerName overrides the name sent as SNI and verified against the certificate, the URL host by default
+	ServerName string
+	// MinVersion and MaxVersion are like "1.2" or "1.3"
+	MinVersion string
+	MaxVersion string
+	// CipherSuites are names like TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, TLS 1.3 suites can't be configured
+	CipherSuites []string
+}
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// build loads certificates of the config, nil config means the transport defaults.
+func (c TLSConfig) build() (*tls.Config, error) {
+	if c.isZero() {
+		return nil, nil
+	}
+	config := &tls.Config{InsecureSkipVerify: c.InsecureSkipVerify, ServerName: c.ServerName}
+
+	if c.CAFile != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		pem, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("ca: %w", err)
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("ca [%v] has no PEM certificates", c.CAFile)
+		}
+		config.RootCAs = pool
+	}
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		return nil, errors.New("client certificate requires both cert and key")
+	}
+	if c.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	var err error
+	if config.MinVersion, err = parseTLSVersion(c.MinVersion); err != nil {
+		return nil, err
+	}
+	if config.MaxVersion, err = parseTLSVersion(c.MaxVersion); err != nil {
+		return nil, err
+	}
+	if config.MinVersion != 0 && config.MaxVersion != 0 && config.MinVersion > config.MaxVersion {
+		return nil, fmt.Errorf("min TLS version [%v] is above max [%v]", c.MinVersion, c.MaxVersion)
+	}
+	if config.CipherSuites, err = parseCipherSuites(c.CipherSuites); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+func (c TLSConfig) isZero() bool {
+	return c.CAFile == "" && c.CertFile == "" && c.KeyFile == "" && !c.InsecureSkipVerify && c.ServerName == "" &&
+		c.MinVersion == "" && c.MaxVersion == "" && len(c.CipherSuites) == 0
+}
+
+func parseTLSVersion(v string) (uint16, error) {
+	if v == "" {
+		return 0, nil
+	}
+	version, ok := tlsVersions[strings.TrimPrefix(strings.ToLower(v), "tls")]
+	if !ok {
+		return 0, fmt.Errorf("unknown TLS version [%v], expected one of 1.0, 1.1, 1.2 or 1.3", v)
+	}
+	return version, nil
+}
+
+// parseCipherSuites resolves names of suites, insecure ones are allowed since testing them may be the point.
+func parseCipherSuites(names []string) ([]uint16, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	known := make(map[string]uint16)
+	for _, s := range append(tls.CipherSuites(), tls.InsecureCipherSuites()...) {
+		known[s.Name] = s.ID
+	}
+	ids := make([]uint16, 0, len(names))
+	for _, name := range names {
+		id, ok := known[strings.ToUpper(name)]
+		if !ok {
+			return nil, fmt.Errorf("unknown cipher suite [%v]", name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// negotiatedProtocol describes the protocol a response arrived over, e.g. "HTTP/1.1 TLS 1.3 TLS_AES_128_GCM_SHA256".
+func negotiatedProtocol(res *http.Response) string {
+	if res.TLS == nil {
+		return res.Proto
+	}
+	return fmt.Sprintf("%v %v %v", res.Proto, tls.VersionName(res.TLS.Version), tls.CipherSuiteName(res.TLS.CipherSuite))
+}
@@ -0,0 +1,358 @@
+package runnables
+
+import (
+	"aggressive-pokes/internal/ltlogger"
+	"aggressive-pokes/internal/stats"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"golang.org/x/net/websocket"
+	"net"
+	"net/url"
+	"regexp"
+	"time"
+)
+
+// Reasons of WebSocket executions on top of transport errors classified by ClassifyError.
+const (
+	ReasonWebSocketOK           = "ws_ok"
+	ReasonWebSocketHandshake    = "ws_handshake_error" // the server refused the upgrade
+	ReasonWebSocketReplyTimeout = "ws_reply_timeout"   // no reply matched the expectation in time
+	ReasonWebSocketClosed       = "ws_closed"          // the connection was closed before the session ended
+	ReasonWebSocketError        = "ws_error"
+)
+
+// Steps of a session, reported as the step tag along with names of script steps.
+const (
+	StepConnect = "connect" // from dialing to the completed handshake
+	StepSession = "session" // lifetime of the connection, along with bytes sent and received over it
+)
+
+// WebSocketConfig describes the session of a virtual user.
+type WebSocketConfig struct {
+	URL string
+	// Origin is sent in the handshake, the URL over http(s) by default
+	Origin       string
+	Headers      map[string]string
+	Subprotocols []string
+	Script       []WebSocketStep
+	// HoldFor keeps the connection open since connecting, at least as long as the script takes
+	HoldFor time.Duration
+	// RepeatEvery reruns the script while holding the connection, it runs once if zero
+	RepeatEvery time.Duration
+	// ConnectTimeout bounds dialing and the handshake, 10s by default
+	ConnectTimeout time.Duration
+	TLS            TLSConfig
+}
+
+// WebSocketStep sends a message and awaits the reply, either of them may be left out.
+type WebSocketStep struct {
+	// Name is the step tag of the step, "step N" by default
+	Name string
+	// Send is a Template rendered per session, {{ .session }} is an id of the session
+	Send string
+	// Expect is a regexp the reply must match, other messages arriving in the meantime are skipped
+	Expect string
+	// Timeout bounds waiting for the reply, 5s by default
+	Timeout time.Duration
+}
+
+type webSocketStep struct {
+	name    string
+	send    *Template
+	expect  *regexp.Regexp
+	timeout time.Duration
+}
+
+// WebSocketRunnable runs a session per execution, reporting its steps by the step tag.
+func WebSocketRunnable(logger ltlogger.Logger, config WebSocketConfig) (func(reporter stats.Reporter), error) {
+	location, err := url.Parse(config.URL)
+	if err != nil {
+		return nil, err
+	}
+	if location.Scheme != "ws" && location.Scheme != "wss" {
+		return nil, fmt.Errorf("websocket url [%v] should start with ws:// or wss://", config.URL)
+	}
+	origin := config.Origin
+	if origin == "" {
+		origin = "http://" + location.Host
+		if location.Scheme == "wss" {
+			origin = "https://" + location.Host
+		}
+	}
+	wsConfig, err := websocket.NewConfig(config.URL, origin)
+	if err != nil {
+		return nil, err
+	}
+	wsConfig.Protocol = config.Subprotocols
+	for k, v := range config.Headers {
+		wsConfig.Header.Set(k, v)
+	}
+	if location.Scheme == "wss" {
+		if wsConfig.TlsConfig, err = config.TLS.build(); err != nil {
+			return nil, fmt.Errorf("tls: %w", err)
+		}
+	}
+	if config.ConnectTimeout == 0 {
+		config.ConnectTimeout = 10 * time.Second
+	}
+
+	steps := make([]webSocketStep, 0, len(config.Script))
+	for i, s := range config.Script {
+		step := webSocketStep{name: s.Name, timeout: s.Timeout}
+		if step.name == "" {
+			step.name = fmt.Sprintf("step %v", i+1)
+		}
+		if step.timeout == 0 {
+			step.timeout = 5 * time.Second
+		}
+		if s.Send != "" {
+			if step.send, err = NewTemplate(s.Send, sessionData()); err != nil {
+				return nil, fmt.Errorf("step [%v]: %w", step.name, err)
+			}
+		}
+		if s.Expect != "" {
+			if step.expect, err = regexp.Compile(s.Expect); err != nil {
+				return nil, fmt.Errorf("step [%v]: %w", step.name, err)
+			}
+		}
+		if step.send == nil && step.expect == nil {
+			return nil, fmt.Errorf("step [%v] neither sends nor expects", step.name)
+		}
+		steps = append(steps, step)
+	}
+
+	tags := stats.Tags{"endpoint": location.Path}
+	logger.Info("Initialized websocket client", "url", config.URL, "steps", len(steps), "holdFor", config.HoldFor)
+
+	return func(reporter stats.Reporter) {
+		s := &webSocketSession{config: config, wsConfig: wsConfig, steps: steps, reporter: reporter.WithTags(tags), ctx: reporter.Context(), data: sessionData()}
+		s.run()
+	}, nil
+}
+
+type webSocketSession struct {
+	config   WebSocketConfig
+	wsConfig *websocket.Config
+	steps    []webSocketStep
+	reporter stats.Reporter
+	ctx      context.Context // done once the stage stops, which ends the session early
+	data     map[string]any  // rendered into messages of the session
+	conn     *websocket.Conn
+	messages chan []byte // closed by the reader once the connection breaks, readErr tells why
+	readErr  error
+	sent     int64
+	received int64 // written by the reader, read once messages are closed
+}
+
+// run connects, runs the script and holds the connection until the hold ends or the stage stops.
+func (s *webSocketSession) run() {
+	start := time.Now()
+	if err := s.connect(); err != nil {
+		// dials interrupted by the stage stopping aren't failures of the target
+		if s.ctx.Err() == nil {
+			s.report(StepConnect, classifyWebSocketError(err), err, time.Since(start))
+		}
+		return
+	}
+	connected := time.Now()
+	s.report(StepConnect, ReasonWebSocketOK, nil, connected.Sub(start))
+	s.messages = make(chan []byte, 64)
+	go s.read()
+
+	holdUntil := connected.Add(s.config.HoldFor)
+	err := s.runScript()
+	for err == nil && s.ctx.Err() == nil && s.config.RepeatEvery > 0 && time.Now().Add(s.config.RepeatEvery).Before(holdUntil) {
+		if err = s.idle(time.Now().Add(s.config.RepeatEvery)); err == nil {
+			err = s.runScript()
+		}
+	}
+	if err == nil {
+		err = s.idle(holdUntil)
+	}
+	_ = s.conn.Close()
+	for range s.messages {
+		// drains until the reader notices the close, so received bytes are final
+	}
+
+	e := stats.Execution{
+		Reason:   ReasonWebSocketOK,
+		Elapsed:  time.Since(connected),
+		Tags:     stats.Tags{"step": StepSession},
+		Sent:     stats.Size{Body: s.sent, Decoded: s.sent},
+		Received: stats.Size{Body: s.received, Decoded: s.received},
+	}
+	if err != nil {
+		e.Reason, e.Message, e.Failed = classifyWebSocketError(err), err.Error(), true
+	}
+	s.reporter.ReportExecution(e)
+}
+
+func (s *webSocketSession) connect() error {
+	deadline := time.Now().Add(s.config.ConnectTimeout)
+	dialer := &net.Dialer{Deadline: deadline}
+	host := s.wsConfig.Location.Host
+	if s.wsConfig.Location.Port() == "" {
+		port := "80"
+		if s.wsConfig.Location.Scheme == "wss" {
+			port = "443"
+		}
+		host = net.JoinHostPort(s.wsConfig.Location.Hostname(), port)
+	}
+	var (
+		conn net.Conn
+		err  error
+	)
+	if s.wsConfig.Location.Scheme == "wss" {
+		config := &tls.Config{}
+		if s.wsConfig.TlsConfig != nil {
+			config = s.wsConfig.TlsConfig.Clone()
+		}
+		if config.ServerName == "" {
+			config.ServerName = s.wsConfig.Location.Hostname()
+		}
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: config}).DialContext(s.ctx, "tcp", host)
+	} else {
+		conn, err = dialer.DialContext(s.ctx, "tcp", host)
+	}
+	if err != nil {
+		return err
+	}
+	_ = conn.SetDeadline(deadline)
+	if s.conn, err = websocket.NewClient(s.wsConfig, conn); err != nil {
+		_ = conn.Close()
+		return err
+	}
+	_ = conn.SetDeadline(time.Time{})
+	return nil
+}
+
+func (s *webSocketSession) read() {
+	defer close(s.messages)
+	for {
+		var msg []byte
+		if err := websocket.Message.Receive(s.conn, &msg); err != nil {
+			s.readErr = err
+			return
+		}
+		s.received += int64(len(msg))
+		s.messages <- msg
+	}
+}
+
+// runScript runs steps until one fails, returning the error only when the connection broke.
+func (s *webSocketSession) runScript() error {
+	for _, step := range s.steps {
+		if s.ctx.Err() != nil {
+			return nil
+		}
+		start := time.Now()
+		if step.send != nil {
+			msg, err := step.send.Execute(s.data)
+			if err != nil {
+				s.report(step.name, ReasonRequestSetup, err, time.Since(start))
+				return nil
+			}
+			if err := websocket.Message.Send(s.conn, string(msg)); err != nil {
+				s.report(step.name, classifyWebSocketError(err), err, time.Since(start))
+				return err
+			}
+			s.sent += int64(len(msg))
+		}
+		if step.expect == nil {
+			continue
+		}
+		err := s.await(step)
+		if errors.Is(err, errSessionCanceled) {
+			return nil
+		}
+		s.report(step.name, classifyWebSocketError(err), err, time.Since(start))
+		if errors.Is(err, errReplyTimeout) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func sessionData() map[string]any {
+	return map[string]any{"session": uuid.NewString()}
+}
+
+var (
+	errReplyTimeout    = errors.New("no reply matched in time")
+	errSessionCanceled = errors.New("session canceled")
+)
+
+// await skips messages until one matches the expectation of step.
+func (s *webSocketSession) await(step webSocketStep) error {
+	timeout := time.NewTimer(step.timeout)
+	defer timeout.Stop()
+	for {
+		select {
+		case msg, ok := <-s.messages:
+			if !ok {
+				return s.closedErr()
+			}
+			if step.expect.Match(msg) {
+				return nil
+			}
+		case <-timeout.C:
+			return fmt.Errorf("%w: %v", errReplyTimeout, step.expect)
+		case <-s.ctx.Done():
+			return errSessionCanceled
+		}
+	}
+}
+
+// idle holds the connection until the deadline or the session is canceled, discarding messages, e.g. notifications.
+func (s *webSocketSession) idle(until time.Time) error {
+	wait := time.NewTimer(time.Until(until))
+	defer wait.Stop()
+	for {
+		select {
+		case _, ok := <-s.messages:
+			if !ok {
+				return s.closedErr()
+			}
+		case <-wait.C:
+			return nil
+		case <-s.ctx.Done():
+			return nil
+		}
+	}
+}
+
+func (s *webSocketSession) closedErr() error {
+	return fmt.Errorf("%w: %v", errConnectionClosed, s.readErr)
+}
+
+var errConnectionClosed = errors.New("connection closed")
+
+func (s *webSocketSession) report(step, reason string, err error, elapsed time.Duration) {
+	e := stats.Execution{Reason: reason, Elapsed: elapsed, Tags: stats.Tags{"step": step}}
+	if err != nil {
+		e.Failed, e.Message = true, err.Error()
+	}
+	s.reporter.ReportExecution(e)
+}
+
+func classifyWebSocketError(err error) string {
+	var protocolErr *websocket.ProtocolError
+	switch {
+	case err == nil:
+		return ReasonWebSocketOK
+	case errors.Is(err, errReplyTimeout):
+		return ReasonWebSocketReplyTimeout
+	case errors.Is(err, errConnectionClosed):
+		return ReasonWebSocketClosed
+	case errors.As(err, &protocolErr):
+		return ReasonWebSocketHandshake
+	default:
+		return ClassifyError(err, ReasonWebSocketError)
+	}
+}
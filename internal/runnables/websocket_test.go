@@ -0,0 +1,119 @@
+package runnables
+
+import (
+	"context"
+	"golang.org/x/net/websocket"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newEchoServer echoes messages back, except for those starting with "quiet".
+func newEchoServer(t *testing.T) string {
+	srv := httptest.NewServer(websocket.Handler(func(conn *websocket.Conn) {
+		for {
+			var msg string
+			if err := websocket.Message.Receive(conn, &msg); err != nil {
+				return
+			}
+			if strings.HasPrefix(msg, "quiet") {
+				continue
+			}
+			if err := websocket.Message.Send(conn, msg); err != nil {
+				return
+			}
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return "ws" + strings.TrimPrefix(srv.URL, "http")
+}
+
+// steps lists the step tag and reason of every execution.
+func (r *recorder) steps() []string {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	var steps []string
+	for _, e := range r.executions {
+		steps = append(steps, e.Tags["step"]+":"+e.Reason)
+	}
+	return steps
+}
+
+func TestWebSocketSession(t *testing.T) {
+	tests := []struct {
+		name   string
+		script []WebSocketStep
+		stop   time.Duration // the stage stops after it, unless zero
+		steps  string
+	}{
+		{
+			name:   "echo",
+			script: []WebSocketStep{{Name: "hello", Send: "hi {{ .session }}", Expect: "^hi "}, {Name: "notify", Send: "quiet"}},
+			steps:  "connect:ws_ok hello:ws_ok session:ws_ok",
+		},
+		{
+			name:   "reply timeout",
+			script: []WebSocketStep{{Name: "hello", Send: "quiet", Expect: "never", Timeout: 50 * time.Millisecond}},
+			steps:  "connect:ws_ok hello:ws_reply_timeout session:ws_ok",
+		},
+		{
+			// a step interrupted awaiting its reply isn't reported, the session ends without failing
+			name:   "stopped awaiting reply",
+			script: []WebSocketStep{{Name: "hello", Send: "quiet", Expect: "never"}},
+			stop:   50 * time.Millisecond,
+			steps:  "connect:ws_ok session:ws_ok",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runnable, err := WebSocketRunnable(testLogger(), WebSocketConfig{URL: newEchoServer(t), Script: tt.script})
+			if err != nil {
+				t.Fatal(err)
+			}
+			rec, reporter := newRecorder()
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tt.stop > 0 {
+				time.AfterFunc(tt.stop, cancel)
+			}
+			runnable(reporter.WithContext(ctx))
+			if steps := strings.Join(rec.steps(), " "); steps != tt.steps {
+				t.Errorf("reported %v, want %v", steps, tt.steps)
+			}
+		})
+	}
+}
+
+func TestWebSocketHoldStopped(t *testing.T) {
+	runnable, err := WebSocketRunnable(testLogger(), WebSocketConfig{URL: newEchoServer(t), HoldFor: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec, reporter := newRecorder()
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	start := time.Now()
+	runnable(reporter.WithContext(ctx))
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("session held for %v once the stage stopped", elapsed)
+	}
+	if steps := strings.Join(rec.steps(), " "); steps != "connect:ws_ok session:ws_ok" {
+		t.Errorf("reported %v, want the session ended without failing", steps)
+	}
+}
+
+func TestWebSocketServerClosed(t *testing.T) {
+	srv := httptest.NewServer(websocket.Handler(func(conn *websocket.Conn) {}))
+	defer srv.Close()
+	runnable, err := WebSocketRunnable(testLogger(), WebSocketConfig{URL: "ws" + strings.TrimPrefix(srv.URL, "http"), HoldFor: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec, reporter := newRecorder()
+	runnable(reporter)
+	if steps := strings.Join(rec.steps(), " "); steps != "connect:ws_ok session:ws_closed" {
+		t.Errorf("reported %v, want the session closed", steps)
+	}
+}
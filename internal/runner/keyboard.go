@@ -0,0 +1,58 @@
+package runner
+
+import (
+	"aggressive-pokes/internal/utils"
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const keyboardHelp = "Commands: [p] pause, [r] resume, [s] stop, [<n>] set qps to n, [+<n>]/[-<n>] change qps by n"
+
+// ControlFrom reads commands line by line from r, e.g. os.Stdin, until it's exhausted.
+// Meant to be run in its own goroutine alongside Start.
+func (t *LoadTest) ControlFrom(r io.Reader) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if err := t.command(strings.TrimSpace(scanner.Text())); err != nil {
+			utils.PrintBoxed("Command failed", err.Error(), keyboardHelp)
+		}
+	}
+}
+
+func (t *LoadTest) command(cmd string) error {
+	switch cmd {
+	case "":
+		return nil
+	case "p":
+		return t.Pause()
+	case "r":
+		return t.Resume()
+	case "s":
+		t.Stop()
+		return nil
+	}
+
+	n, err := strconv.Atoi(strings.TrimPrefix(cmd, "+"))
+	if err != nil {
+		return fmt.Errorf("unknown command [%v]", cmd)
+	}
+	if !strings.HasPrefix(cmd, "+") && !strings.HasPrefix(cmd, "-") {
+		return t.SetQps(n)
+	}
+	qps, err := t.currentQps()
+	if err != nil {
+		return err
+	}
+	return t.SetQps(qps + n)
+}
+
+func (t *LoadTest) currentQps() (int, error) {
+	stage, err := t.controllable()
+	if err != nil {
+		return 0, err
+	}
+	return stage.currentQps(), nil
+}
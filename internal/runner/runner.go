@@ -1,28 +1,112 @@
 package runner
 
 import (
+	"aggressive-pokes/internal/history"
+	"aggressive-pokes/internal/results"
 	"aggressive-pokes/internal/stats"
 	"aggressive-pokes/internal/utils"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"path/filepath"
+	"strings"
+	"sync"
 	"time"
 )
 
+// unnamed labels metrics of load tests which weren't given a name.
+const unnamed = "unnamed"
+
 type LoadTest struct {
-	stages []stageRunner
+	id         string
+	name       string
+	target     *results.Target
+	stages     []stageRunner
+	startTime  time.Time
+	endTime    time.Time
+	resultsDir string
+	sinks      []Sink
+	captures   []Capture
+	current    stageRunner
+	cancel     context.CancelFunc
+	mx         *sync.Mutex
 	//runnable func(reporter stats.Reporter)
 }
 
 func NewLoadTest() LoadTest {
 	return LoadTest{
+		id:   uuid.NewString(),
+		name: unnamed,
+		mx:   &sync.Mutex{},
 		//runnable: runnable,
 	}
 }
 
-func (t *LoadTest) AddQpsStage(qps int, duration time.Duration, runnable func(reporter stats.Reporter)) {
-	t.stages = append(t.stages, newStageQps(len(t.stages)+1, qps, duration, runnable))
+func (t *LoadTest) ID() string {
+	return t.id
+}
+
+// SetName names the load test, the name labels exposed metrics so runs of the same scenario can be told apart from others.
+func (t *LoadTest) SetName(name string) {
+	t.name = name
+}
+
+func (t *LoadTest) Name() string {
+	return t.name
+}
+
+// SetTarget describes what the load test pokes in its result.
+func (t *LoadTest) SetTarget(target results.Target) {
+	t.target = &target
+}
+
+// Sink provides a stats sink for every stage of a load test, e.g. a metrics registry or a time-series backend.
+// Sinks which have a Close method are closed once Start is done.
+type Sink interface {
+	Stage(scenario string, stage int) stats.Sink
+}
+
+// Capture saves requests and responses of a load test, e.g. capture.Capturer.
+// Captures are closed once Start is done and their files are listed in the run summary and result.
+type Capture interface {
+	Files() []string
+	Close()
+}
+
+// Close closes sinks and captures, Start does once it's done, so only tests which won't be started need it.
+func (t *LoadTest) Close() {
+	for _, sink := range t.sinks {
+		if closer, ok := sink.(interface{ Close() }); ok {
+			closer.Close()
+		}
+	}
+	for _, c := range t.captures {
+		c.Close()
+	}
+}
+
+func (t *LoadTest) AddCapture(c Capture) {
+	t.captures = append(t.captures, c)
 }
 
-func (t *LoadTest) AddAbsoluteStage(amount, asyncFactor int, runnable func(reporter stats.Reporter)) {
-	t.stages = append(t.stages, newStageAbsolute(len(t.stages)+1, amount, asyncFactor, runnable))
+// AddSink makes every stage record its executions into sink on top of the stage stats.
+func (t *LoadTest) AddSink(sink Sink) {
+	t.sinks = append(t.sinks, sink)
+}
+
+func (t *LoadTest) AddQpsStage(qps int, duration time.Duration, runnable func(reporter stats.Reporter), opts ...StageOption) {
+	t.stages = append(t.stages, newStageQps(len(t.stages)+1, qps, duration, runnable, opts...))
+}
+
+func (t *LoadTest) AddAbsoluteStage(amount, asyncFactor int, runnable func(reporter stats.Reporter), opts ...StageOption) {
+	t.stages = append(t.stages, newStageAbsolute(len(t.stages)+1, amount, asyncFactor, runnable, opts...))
+}
+
+// ExportResults makes Start write the run result as JSON and CSV files along with an HTML report into dir
+// and index it there, so the run can be compared with previous ones.
+func (t *LoadTest) ExportResults(dir string) {
+	t.resultsDir = dir
 }
 
 func (t *LoadTest) Start() {
@@ -30,11 +114,158 @@ func (t *LoadTest) Start() {
 		panic("No stages to poke around")
 	}
 
-	for _, s := range t.stages {
-		s.run()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	t.mx.Lock()
+	t.cancel = cancel
+	t.mx.Unlock()
+
+	t.mx.Lock()
+	t.startTime = time.Now()
+	t.mx.Unlock()
+	for i, s := range t.stages {
+		if ctx.Err() != nil {
+			break
+		}
+		for _, sink := range t.sinks {
+			s.addSink(sink.Stage(t.name, i+1))
+		}
+		t.setCurrent(s)
+		s.run(ctx)
 	}
+	t.setCurrent(nil)
+	t.mx.Lock()
+	t.endTime = time.Now()
+	t.mx.Unlock()
+	t.Close()
+
 	utils.ClearConsole()
 	for _, s := range t.stages {
 		utils.PrintBoxed("", s.format())
 	}
+	if files := t.captureFiles(); len(files) > 0 {
+		utils.PrintBoxed("Captured requests", files...)
+	}
+	if t.resultsDir != "" {
+		t.export()
+	}
+}
+
+// Stop interrupts the running stage and skips the remaining ones, results collected so far are kept.
+func (t *LoadTest) Stop() {
+	t.mx.Lock()
+	defer t.mx.Unlock()
+
+	if t.cancel != nil {
+		t.cancel()
+	}
+}
+
+// Pause stops submitting tasks of the running stage until Resume is called.
+func (t *LoadTest) Pause() error {
+	stage, err := t.controllable()
+	if err != nil {
+		return err
+	}
+	return stage.pause()
+}
+
+func (t *LoadTest) Resume() error {
+	stage, err := t.controllable()
+	if err != nil {
+		return err
+	}
+	return stage.resume()
+}
+
+// SetQps changes the target qps of the running stage.
+func (t *LoadTest) SetQps(qps int) error {
+	if qps < 1 || qps > 1_000_000 {
+		return fmt.Errorf("qps [%v] should be in range [1, 1_000_000]", qps)
+	}
+	stage, err := t.controllable()
+	if err != nil {
+		return err
+	}
+	return stage.setQps(qps)
+}
+
+func (t *LoadTest) setCurrent(s stageRunner) {
+	t.mx.Lock()
+	defer t.mx.Unlock()
+	t.current = s
+}
+
+func (t *LoadTest) controllable() (controllableStage, error) {
+	t.mx.Lock()
+	defer t.mx.Unlock()
+
+	if t.current == nil {
+		return nil, errors.New("no stage is running")
+	}
+	stage, ok := t.current.(controllableStage)
+	if !ok {
+		return nil, errors.New("running stage can't be controlled, only qps stages can")
+	}
+	return stage, nil
+}
+
+// Status reports the progress of every stage, it can be called while the test is running.
+func (t *LoadTest) Status() []StageStatus {
+	statuses := make([]StageStatus, 0, len(t.stages))
+	for _, s := range t.stages {
+		statuses = append(statuses, s.status())
+	}
+	return statuses
+}
+
+// Result collects config and stats of every stage, it is complete once Start returns
+// and can be called while running for live stats.
+func (t *LoadTest) Result() results.Run {
+	return t.FilteredResult(nil)
+}
+
+// FilteredResult is Result narrowed down to executions having every tag of filter, stats.ReasonTag included.
+func (t *LoadTest) FilteredResult(filter stats.Tags) results.Run {
+	t.mx.Lock()
+	startTime, endTime := t.startTime, t.endTime
+	t.mx.Unlock()
+
+	run := results.Run{
+		SchemaVersion: results.SchemaVersion,
+		ID:            t.id,
+		Scenario:      t.name,
+		Target:        t.target,
+		StartTime:     startTime,
+		EndTime:       endTime,
+		Stages:        make([]results.Stage, 0, len(t.stages)),
+	}
+	for _, s := range t.stages {
+		run.Stages = append(run.Stages, s.result(filter))
+	}
+	run.Captures = t.captureFiles()
+	return run
+}
+
+// captureFiles lists absolute paths of capture files, so they can be opened from wherever the results end up.
+func (t *LoadTest) captureFiles() []string {
+	var files []string
+	for _, c := range t.captures {
+		for _, f := range c.Files() {
+			if abs, err := filepath.Abs(f); err == nil {
+				f = abs
+			}
+			files = append(files, f)
+		}
+	}
+	return files
+}
+
+func (t *LoadTest) export() {
+	paths, err := history.NewStore(t.resultsDir).Save(t.Result())
+	if err != nil {
+		utils.PrintBoxed("Results export failed", err.Error())
+		return
+	}
+	utils.PrintBoxed("Results exported", fmt.Sprintf("Files: %v", strings.Join(paths, ", ")))
 }
@@ -1,12 +1,15 @@
 package runner
 
 import (
+	"aggressive-pokes/internal/results"
 	"aggressive-pokes/internal/stats"
 	"aggressive-pokes/internal/utils"
 	"aggressive-pokes/internal/worker"
 	"context"
+	"errors"
 	"fmt"
 	"runtime"
+	"sync"
 	"time"
 )
 
@@ -18,64 +21,459 @@ const (
 	stateDone
 )
 
+func (s stageState) String() string {
+	switch s {
+	case stateRunning:
+		return "running"
+	case stateDone:
+		return "done"
+	default:
+		return "pending"
+	}
+}
+
+// StageStatus describes the live progress of a stage.
+type StageStatus struct {
+	ID       int           `json:"id"`
+	State    string        `json:"state"`
+	Paused   bool          `json:"paused"`
+	Load     string        `json:"load"`
+	Progress float64       `json:"progress"` // in range [0, 1]
+	Elapsed  time.Duration `json:"elapsed_ns"`
+	Left     time.Duration `json:"left_ns"`
+}
+
 type stageRunner interface {
-	run()
+	run(ctx context.Context)
 	runTaskRoutine(ctx context.Context)
 	runReportRoutine(ctx context.Context, interval time.Duration)
 	format() string
+	status() StageStatus
+	result(filter stats.Tags) results.Stage
+	addSink(sink stats.Sink)
 }
 
 type baseStage struct {
-	id        int
+	id            int
+	stats         *stats.StageStats
+	warmup        time.Duration
+	warmupStats   *stats.StageStats
+	cooldown      time.Duration
+	cooldownStats *stats.StageStats
+	percentiles   []float64
+	window        time.Duration
+	thresholds    []threshold
+	tags          stats.Tags
+	groupBy       []string
+	runnable      func(reporter stats.Reporter)
+	phases        *stats.PhasedSink
+	sinks         []stats.Sink
+	lifecycleMx   *sync.Mutex
+	state         stageState
+	startTime     time.Time
+	endTime       time.Time
+}
+
+// lifecycle is a consistent copy of the stage state and boundaries, which are written by stage routines
+// while status, reports and exports read them.
+type lifecycle struct {
+	state     stageState
 	startTime time.Time
 	endTime   time.Time
-	stats     *stats.StageStats
-	runnable  func(reporter stats.Reporter)
-	state     stageState
+}
+
+func (s *baseStage) lifecycle() lifecycle {
+	s.lifecycleMx.Lock()
+	defer s.lifecycleMx.Unlock()
+	return lifecycle{state: s.state, startTime: s.startTime, endTime: s.endTime}
+}
+
+// begin marks the stage running from now on and returns the start time.
+func (s *baseStage) begin() time.Time {
+	s.lifecycleMx.Lock()
+	defer s.lifecycleMx.Unlock()
+	s.startTime = time.Now()
+	s.state = stateRunning
+	return s.startTime
+}
+
+// setEnd sets the end of the stage, planned while running and actual once done.
+func (s *baseStage) setEnd(end time.Time) {
+	s.lifecycleMx.Lock()
+	defer s.lifecycleMx.Unlock()
+	s.endTime = end
+}
+
+func (s *baseStage) finish() {
+	s.lifecycleMx.Lock()
+	defer s.lifecycleMx.Unlock()
+	s.state = stateDone
+}
+
+func (l lifecycle) duration() time.Duration {
+	return l.endTime.Sub(l.startTime)
+}
+
+// StageOption tunes a stage beyond its load profile.
+type StageOption func(s *baseStage)
+
+// WithWarmup records executions started during the first d of the stage separately,
+// so connection pool and cache warming don't pollute the stage stats.
+// For qps stages the warmup is run on top of the stage duration.
+func WithWarmup(d time.Duration) StageOption {
+	return func(s *baseStage) {
+		s.warmup = d
+	}
+}
+
+// WithCooldown lets in-flight and queued executions drain for up to d after the stage stops submitting,
+// recording them separately. Applies to qps stages only.
+func WithCooldown(d time.Duration) StageOption {
+	return func(s *baseStage) {
+		s.cooldown = d
+	}
+}
+
+// WithPercentiles overrides stats.DefaultPercentiles reported in the stage summary.
+func WithPercentiles(percentiles ...float64) StageOption {
+	for _, p := range percentiles {
+		if p <= 0 || p > 100 {
+			panic(fmt.Sprintf("Percentile [%v] should be in range (0, 100]", p))
+		}
+	}
+	return func(s *baseStage) {
+		s.percentiles = percentiles
+	}
+}
+
+// WithWindow sets the resolution of the stage time series, stats.DefaultWindow by default.
+func WithWindow(d time.Duration) StageOption {
+	if d < 100*time.Millisecond {
+		panic("Window should be at least 100ms")
+	}
+	return func(s *baseStage) {
+		s.window = d
+	}
+}
+
+// WithSink records every execution of the stage into sink on top of the stage stats, e.g. a custom output.
+func WithSink(sink stats.Sink) StageOption {
+	return func(s *baseStage) {
+		s.addSink(sink)
+	}
+}
+
+// WithTags attaches tags to every execution of the stage, on top of tags reported by the runnable.
+func WithTags(tags stats.Tags) StageOption {
+	return func(s *baseStage) {
+		s.tags = s.tags.With(tags)
+	}
+}
+
+// WithGroupBy sets the tags the stage summary is grouped by, stats.ReasonTag groups by reason which is the default.
+func WithGroupBy(tags ...string) StageOption {
+	if len(tags) == 0 {
+		panic("GroupBy should name at least one tag")
+	}
+	return func(s *baseStage) {
+		s.groupBy = tags
+	}
+}
+
+func (s *baseStage) init(opts []StageOption) {
+	s.lifecycleMx = &sync.Mutex{}
+	s.state = stateInit
+	s.percentiles = stats.DefaultPercentiles
+	s.window = stats.DefaultWindow
+	s.groupBy = []string{stats.ReasonTag}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	s.stats = stats.NewWindowedStageStats(s.window)
+	if s.warmup > 0 {
+		s.warmupStats = stats.NewWindowedStageStats(s.window)
+	}
+	if s.cooldown > 0 {
+		s.cooldownStats = stats.NewWindowedStageStats(s.window)
+	}
+}
+
+// addSink makes reporters of the stage record every execution into sink as well.
+func (s *baseStage) addSink(sink stats.Sink) {
+	s.sinks = append(s.sinks, sink)
+}
+
+// newReporter fans executions out to the stage stats, routed by phase, followed by the added sinks.
+func (s *baseStage) newReporter() stats.Reporter {
+	s.phases = stats.NewPhasedSink(s.stats, s.warmupStats, s.cooldownStats, time.Now().Add(s.warmup))
+	return stats.NewReporter(append([]stats.Sink{s.phases}, s.sinks...)...).WithTags(s.tags)
+}
+
+func (s *baseStage) executed() int {
+	executed := s.stats.Executed()
+	if s.warmupStats != nil {
+		executed += s.warmupStats.Executed()
+	}
+	return executed
+}
+
+// currentStats are the stats currently recorded into, elapsed being the time the stage ran for without pauses.
+func (s *baseStage) currentStats(elapsed time.Duration) *stats.StageStats {
+	if s.warmupStats != nil && elapsed < s.warmup {
+		return s.warmupStats
+	}
+	return s.stats
+}
+
+// annotate marks the stats timeline, so adjustments show up in exports and charts.
+func (s *baseStage) annotate(elapsed time.Duration, msg string) {
+	s.currentStats(elapsed).Annotate(msg)
+}
+
+// formatLastWindow renders the latest complete window of whichever stats are currently recorded into.
+func (s *baseStage) formatLastWindow(elapsed time.Duration) string {
+	w, ok := s.currentStats(elapsed).LastCompleteWindow()
+	if !ok {
+		return fmt.Sprintf("Last [%v]: no data yet", s.window)
+	}
+	return fmt.Sprintf("Last [%v]: %v", s.window, w.Format(s.percentiles...))
+}
+
+// formatStats renders st grouped by the stage group by tags.
+func (s *baseStage) formatStats(st *stats.StageStats) string {
+	return st.FormatGrouped(s.groupBy, s.percentiles...)
+}
+
+// formatSummary renders warmup and cooldown stats along with verdicts of the stage thresholds.
+func (s *baseStage) formatSummary() string {
+	var summary string
+	if s.warmupStats != nil {
+		summary += fmt.Sprintf("Warmup [%v]:\n%v\n", utils.PrettyDuration(s.warmup), s.formatStats(s.warmupStats))
+	}
+	if s.cooldownStats != nil {
+		summary += fmt.Sprintf("Cooldown [%v]:\n%v\n", utils.PrettyDuration(s.cooldown), s.formatStats(s.cooldownStats))
+	}
+	snapshot := s.stats.Snapshot()
+	if samples := snapshot.FormatErrorSamples(); samples != "" {
+		summary += samples + "\n"
+	}
+	return summary + formatVerdicts(s.verdicts(snapshot))
+}
+
+// result collects the stage stats, measured duration excludes warmup and cooldown.
+// Stats are narrowed down to executions having every tag of filter, verdicts always judge complete stats.
+func (s *baseStage) result(config results.StageConfig, duration time.Duration, filter stats.Tags) results.Stage {
+	config.WarmupMs = s.warmup.Milliseconds()
+	config.CooldownMs = s.cooldown.Milliseconds()
+	config.WindowMs = s.window.Milliseconds()
+	config.Percentiles = s.percentiles
+	config.Tags = s.tags
+	config.Filter = filter
+
+	snapshot := s.stats.Snapshot()
+	l := s.lifecycle()
+	stage := results.Stage{
+		ID:        s.id,
+		Config:    config,
+		StartTime: l.startTime,
+		EndTime:   l.endTime,
+		Stats:     results.NewPhase(snapshot.Filter(filter), duration, s.percentiles),
+		Verdicts:  s.verdicts(snapshot),
+	}
+	if s.warmupStats != nil {
+		warmup := results.NewPhase(s.warmupStats.Snapshot().Filter(filter), s.warmup, s.percentiles)
+		stage.Warmup = &warmup
+	}
+	if s.cooldownStats != nil {
+		cooldown := results.NewPhase(s.cooldownStats.Snapshot().Filter(filter), s.cooldown, s.percentiles)
+		stage.Cooldown = &cooldown
+	}
+	return stage
+}
+
+// controllableStage is implemented by stages which can be throttled while running.
+type controllableStage interface {
+	pause() error
+	resume() error
+	setQps(qps int) error
+	currentQps() int
 }
 
 type qpsStage struct {
 	baseStage
-	qps      int
-	duration time.Duration
-	interval time.Duration
+	qps       int
+	duration  time.Duration
+	interval  time.Duration
+	paused    bool
+	pausedAt  time.Time
+	pausedFor time.Duration
+	// changed wakes up the task routine to pick up pause, resume and qps changes
+	changed   chan struct{}
+	submitted chan struct{}
+	mx        *sync.Mutex
 }
 
-func (s *qpsStage) run() {
-	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(s.duration))
-	defer cancel()
+func (s *qpsStage) pause() error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
 
-	reporter := stats.NewReporter(s.stats)
-	workersFinished := worker.StartWorkers(ctx, reporter, s.qps*100)
-	s.runReportRoutine(ctx, 1000*time.Millisecond)
-	s.runTaskRoutine(ctx)
+	if s.paused {
+		return errors.New("stage is already paused")
+	}
+	s.paused = true
+	s.pausedAt = time.Now()
+	s.annotate(s.activeElapsedLocked(), "paused")
+	s.notifyChanged()
+	return nil
+}
+
+func (s *qpsStage) resume() error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	if !s.paused {
+		return errors.New("stage isn't paused")
+	}
+	paused := time.Since(s.pausedAt)
+	s.paused = false
+	s.pausedFor += paused
+	s.annotate(s.activeElapsedLocked(), fmt.Sprintf("resumed after %v", paused.Round(time.Second)))
+	s.notifyChanged()
+	return nil
+}
+
+func (s *qpsStage) setQps(qps int) error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	if qps == s.qps {
+		return nil
+	}
+	s.annotate(s.activeElapsedLocked(), fmt.Sprintf("qps %v -> %v", s.qps, qps))
+	s.qps = qps
+	s.interval = qpsInterval(qps)
+	s.notifyChanged()
+	return nil
+}
+
+func (s *qpsStage) currentQps() int {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	return s.qps
+}
+
+// notifyChanged never blocks, a pending notification already covers the latest change.
+func (s *qpsStage) notifyChanged() {
+	select {
+	case s.changed <- struct{}{}:
+	default:
+	}
+}
+
+// activeElapsed is the time the stage has been submitting tasks for, pauses excluded.
+func (s *qpsStage) activeElapsed() time.Duration {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	return s.activeElapsedLocked()
+}
+
+// activeElapsedLocked is activeElapsed for callers holding s.mx.
+func (s *qpsStage) activeElapsedLocked() time.Duration {
+	elapsed := time.Since(s.lifecycle().startTime) - s.pausedFor
+	if s.paused {
+		elapsed -= time.Since(s.pausedAt)
+	}
+	return elapsed
+}
+
+func (s *qpsStage) run(parent context.Context) {
+	workersCtx, cancelWorkers := context.WithCancel(parent)
+	defer cancelWorkers()
+
+	reporter := s.newReporter().WithContext(workersCtx)
+	workersFinished := worker.StartWorkers(workersCtx, reporter, s.currentQps()*100)
+	s.runReportRoutine(workersCtx, 1000*time.Millisecond)
+	s.runTaskRoutine(workersCtx)
 	utils.PrintBoxed("", s.format(), "Starting...")
 
+	go func() {
+		<-s.submitted
+		// queued and in-flight tasks are drained for up to the cooldown
+		time.AfterFunc(s.cooldown, cancelWorkers)
+	}()
 	<-workersFinished
-	s.state = stateDone
+	s.finish()
 
 	utils.PrintBoxed("", s.format())
 }
 
 func (s *qpsStage) runTaskRoutine(ctx context.Context) {
 	go func() {
-		s.startTime = time.Now()
-		s.endTime = s.startTime.Add(s.duration)
-		ticker := time.Tick(s.interval)
-		s.state = stateRunning
+		defer close(s.submitted)
+
+		start := s.begin()
+		s.setEnd(start.Add(s.warmup + s.duration))
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+		deadline := time.NewTimer(s.warmup + s.duration)
+		defer deadline.Stop()
+		var accountedPause time.Duration
 		for {
 			select {
 			case <-ctx.Done():
-				worker.Cancel()
-				//fmt.Printf("Stage #%v task routine done\n", s.id)
+				s.finishSubmitting()
+				return
+			case <-deadline.C:
+				s.finishSubmitting()
 				return
-			case <-ticker:
-				worker.Submit(s.runnable)
+			case <-s.changed:
+				s.mx.Lock()
+				paused, pausedAt, pausedFor, interval := s.paused, s.pausedAt, s.pausedFor, s.interval
+				s.mx.Unlock()
+
+				// a deadline which fired meanwhile would end the stage right after Reset otherwise
+				if !deadline.Stop() {
+					select {
+					case <-deadline.C:
+					default:
+					}
+				}
+				if paused {
+					continue
+				}
+				if resumedAfter := pausedFor - accountedPause; resumedAfter > 0 {
+					// a pause during warmup pushes the warmup end back
+					if pausedAt.Sub(start)-accountedPause < s.warmup {
+						s.phases.DelayWarmup(resumedAfter)
+					}
+					accountedPause = pausedFor
+				}
+				deadline.Reset(s.warmup + s.duration - s.activeElapsed())
+				ticker.Reset(interval)
+			case <-ticker.C:
+				if s.isPaused() {
+					continue
+				}
+				worker.Submit(ctx, s.runnable)
 			}
 		}
 	}()
 }
 
+func (s *qpsStage) isPaused() bool {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	return s.paused
+}
+
+func (s *qpsStage) finishSubmitting() {
+	s.setEnd(time.Now())
+	s.phases.StartCooldown()
+	worker.Cancel()
+	//fmt.Printf("Stage #%v task routine done\n", s.id)
+}
+
 func (s *qpsStage) runReportRoutine(ctx context.Context, interval time.Duration) {
 	reportStatsTicker := time.Tick(interval)
 	go func() {
@@ -87,8 +485,9 @@ func (s *qpsStage) runReportRoutine(ctx context.Context, interval time.Duration)
 			case <-reportStatsTicker:
 				utils.PrintBoxed(
 					s.format(),
-					s.stats.Format(false),
+					s.stats.Format(),
 					utils.SeparatorLine,
+					s.formatLastWindow(s.activeElapsed()),
 					fmt.Sprintf("Goroutines: %-6v |", runtime.NumGoroutine()),
 				)
 			}
@@ -96,65 +495,89 @@ func (s *qpsStage) runReportRoutine(ctx context.Context, interval time.Duration)
 	}()
 }
 
-func (s *qpsStage) format() string {
-	switch s.state {
+func (s *qpsStage) status() StageStatus {
+	s.mx.Lock()
+	l := s.lifecycle()
+	status := StageStatus{ID: s.id, State: l.state.String(), Paused: s.paused, Load: fmt.Sprintf("%v qps for %v", s.qps, s.duration)}
+	s.mx.Unlock()
+	switch l.state {
 	case stateRunning:
-		timeElapsed := time.Since(s.startTime)
-		timeLeft := s.duration - timeElapsed
+		status.Elapsed = s.activeElapsed()
+		status.Left = s.warmup + s.duration - status.Elapsed
+		status.Progress = float64(status.Elapsed) / float64(s.warmup+s.duration)
+		if status.Progress > 1 {
+			status.Progress = 0.99
+		}
+	case stateDone:
+		status.Elapsed = l.duration()
+		status.Progress = 1
+	}
+	return status
+}
 
-		stageProgress := float64(time.Since(s.startTime)) / float64(s.duration)
-		if stageProgress > 1 {
-			stageProgress = 0.99
+func (s *qpsStage) format() string {
+	l := s.lifecycle()
+	switch l.state {
+	case stateRunning:
+		status := s.status()
+		state := "running"
+		if status.Paused {
+			state = "paused"
 		}
-		return fmt.Sprintf("Stage [%v] running, qps: [%v], progress: [%.1f%%], running for: [%v], time left: [%v]",
+		qps := s.currentQps()
+		return fmt.Sprintf("Stage [%v] %v, qps: [%v], progress: [%.1f%%], running for: [%v], time left: [%v]",
 			s.id,
-			s.qps,
-			stageProgress*100,
-			utils.PrettyDuration(timeElapsed),
-			utils.PrettyDuration(timeLeft))
+			state,
+			qps,
+			status.Progress*100,
+			utils.PrettyDuration(status.Elapsed),
+			utils.PrettyDuration(status.Left))
 	case stateDone:
-		return fmt.Sprintf("Stage [%v] done, qps: [%v], duration: [%v]\n%v\n",
-			s.id, s.qps, utils.PrettyDuration(s.endTime.Sub(s.startTime)), s.stats.Format(true))
+		return fmt.Sprintf("Stage [%v] done, qps: [%v], duration: [%v]\n%v\n%v",
+			s.id, s.currentQps(), utils.PrettyDuration(l.duration()), s.formatStats(s.stats), s.formatSummary())
 	default:
-		return fmt.Sprintf("Stage [%v], qps: [%v], duration: %v", s.id, s.qps, s.duration)
+		return fmt.Sprintf("Stage [%v], qps: [%v], duration: %v", s.id, s.currentQps(), s.duration)
 	}
 }
 
+func (s *qpsStage) result(filter stats.Tags) results.Stage {
+	return s.baseStage.result(results.StageConfig{
+		Type:       "qps",
+		Qps:        s.currentQps(),
+		DurationMs: s.duration.Milliseconds(),
+	}, s.duration, filter)
+}
+
 type absoluteStage struct {
 	baseStage
 	amount      int
 	asyncFactor int
 }
 
-func (s *absoluteStage) run() {
-	ctx, cancel := context.WithCancel(context.Background())
+func (s *absoluteStage) run(parent context.Context) {
+	ctx, cancel := context.WithCancel(parent)
 	defer cancel()
 
-	reporter := stats.NewReporter(s.stats)
+	reporter := s.newReporter().WithContext(ctx)
 	workersFinished := worker.StartWorkers(ctx, reporter, s.asyncFactor)
 	s.runReportRoutine(ctx, 1000*time.Millisecond)
 	s.runTaskRoutine(ctx)
 	utils.PrintBoxed("", s.format(), "Starting...")
 
 	<-workersFinished
-	s.state = stateDone
-	s.endTime = time.Now()
+	s.setEnd(time.Now())
+	s.finish()
 
 	utils.PrintBoxed("", s.format())
 }
 
 func (s *absoluteStage) runTaskRoutine(ctx context.Context) {
 	go func() {
-		s.startTime = time.Now()
-		s.state = stateRunning
+		s.begin()
 		for i := 0; i < s.amount; i++ {
-			select {
-			case <-ctx.Done():
-				worker.Cancel()
+			if !worker.Submit(ctx, s.runnable) {
 				//fmt.Printf("Stage #%v task routine done\n", s.id)
-				return
-			default:
-				worker.Submit(s.runnable)
+				break
 			}
 		}
 		worker.Cancel()
@@ -172,8 +595,9 @@ func (s *absoluteStage) runReportRoutine(ctx context.Context, interval time.Dura
 			case <-reportStatsTicker:
 				utils.PrintBoxed(
 					s.format(),
-					s.stats.Format(false),
+					s.stats.Format(),
 					utils.SeparatorLine,
+					s.formatLastWindow(time.Since(s.lifecycle().startTime)),
 					fmt.Sprintf("Goroutines: %-6v |", runtime.NumGoroutine()),
 				)
 			}
@@ -181,48 +605,80 @@ func (s *absoluteStage) runReportRoutine(ctx context.Context, interval time.Dura
 	}()
 }
 
-func (s *absoluteStage) format() string {
-	switch s.state {
+func (s *absoluteStage) status() StageStatus {
+	l := s.lifecycle()
+	status := StageStatus{ID: s.id, State: l.state.String(), Load: fmt.Sprintf("%v executions by %v workers", s.amount, s.asyncFactor)}
+	switch l.state {
 	case stateRunning:
-		timeElapsed := time.Since(s.startTime)
-		stageProgress := float64(s.stats.Executed()) / float64(s.amount)
-		if stageProgress > 1 {
-			stageProgress = 0.99
+		status.Elapsed = time.Since(l.startTime)
+		status.Progress = float64(s.executed()) / float64(s.amount)
+		if status.Progress > 1 {
+			status.Progress = 0.99
 		}
-		timeLeft := time.Duration(float64(timeElapsed.Milliseconds())/stageProgress)*time.Millisecond - timeElapsed
+		status.Left = time.Duration(float64(status.Elapsed.Milliseconds())/status.Progress)*time.Millisecond - status.Elapsed
+	case stateDone:
+		status.Elapsed = l.duration()
+		status.Progress = 1
+	}
+	return status
+}
+
+func (s *absoluteStage) format() string {
+	l := s.lifecycle()
+	switch l.state {
+	case stateRunning:
+		status := s.status()
 		return fmt.Sprintf("Stage [%v] running, amount: [%v], progress: [%.1f%%], running for: [%v], time left: [%v]",
 			s.id,
 			s.amount,
-			stageProgress*100,
-			utils.PrettyDuration(timeElapsed),
-			utils.PrettyDuration(timeLeft))
+			status.Progress*100,
+			utils.PrettyDuration(status.Elapsed),
+			utils.PrettyDuration(status.Left))
 	case stateDone:
-		return fmt.Sprintf("Stage [%v] done, amount: [%v], duration: [%v]\n%v\n",
-			s.id, s.amount, utils.PrettyDuration(s.endTime.Sub(s.startTime)), s.stats.Format(true))
+		return fmt.Sprintf("Stage [%v] done, amount: [%v], duration: [%v]\n%v\n%v",
+			s.id, s.amount, utils.PrettyDuration(l.duration()), s.formatStats(s.stats), s.formatSummary())
 	default:
 		return fmt.Sprintf("Stage [%v], amount: [%v]", s.id, s.amount)
 	}
 }
 
-func newStageQps(id, qps int, duration time.Duration, runnable func(reporter stats.Reporter)) stageRunner {
+func (s *absoluteStage) result(filter stats.Tags) results.Stage {
+	return s.baseStage.result(results.StageConfig{
+		Type:        "absolute",
+		Amount:      s.amount,
+		AsyncFactor: s.asyncFactor,
+	}, s.lifecycle().duration()-s.warmup, filter)
+}
+
+func newStageQps(id, qps int, duration time.Duration, runnable func(reporter stats.Reporter), opts ...StageOption) stageRunner {
 	if duration.Seconds() < 1 || duration.Minutes() > 60 {
 		panic("Duration should be in range [1s, 60m]")
 	}
 
-	return &qpsStage{
+	s := &qpsStage{
 		baseStage: baseStage{
 			id:       id,
 			runnable: runnable,
-			stats:    stats.NewStageStats(),
-			state:    stateInit,
 		},
-		qps:      qps,
-		duration: duration,
-		interval: time.Duration(1_000_000/qps) * time.Microsecond,
+		qps:       qps,
+		duration:  duration,
+		interval:  qpsInterval(qps),
+		changed:   make(chan struct{}, 1),
+		submitted: make(chan struct{}),
+		mx:        &sync.Mutex{},
 	}
+	s.init(opts)
+	return s
 }
 
-func newStageAbsolute(id, amount, asyncFactor int, runnable func(reporter stats.Reporter)) stageRunner {
+func qpsInterval(qps int) time.Duration {
+	if qps < 1 || qps > 1_000_000 {
+		panic("Qps should be in range [1, 1_000_000]")
+	}
+	return time.Duration(1_000_000/qps) * time.Microsecond
+}
+
+func newStageAbsolute(id, amount, asyncFactor int, runnable func(reporter stats.Reporter), opts ...StageOption) stageRunner {
 	if amount < 1 || amount > 1_000_000_000 {
 		panic("Amount should be in range [1, 1_000_000_000]")
 	}
@@ -230,15 +686,17 @@ func newStageAbsolute(id, amount, asyncFactor int, runnable func(reporter stats.
 		panic(fmt.Sprintf("Async factor should be in range [1, %v]", worker.MaxWorkerPool))
 	}
 
-	return &absoluteStage{
+	s := &absoluteStage{
 		baseStage: baseStage{
 			id:       id,
 			runnable: runnable,
-			stats:    stats.NewStageStats(),
-			state:    stateInit,
 		},
 		amount:      amount,
 		asyncFactor: asyncFactor,
 	}
-
+	s.init(opts)
+	if s.cooldownStats != nil {
+		panic("Cooldown is supported by qps stages only")
+	}
+	return s
 }
@@ -0,0 +1,75 @@
+package runner
+
+import (
+	"aggressive-pokes/internal/results"
+	"aggressive-pokes/internal/stats"
+	"fmt"
+	"time"
+)
+
+// threshold is a pass/fail check evaluated against the measured stage stats once the stage is done.
+type threshold struct {
+	check  string
+	limit  float64
+	actual func(snapshot stats.Snapshot) float64
+}
+
+// WithLatencyThreshold fails the stage verdict when percentile p of the stage latency exceeds max.
+func WithLatencyThreshold(p float64, max time.Duration) StageOption {
+	if p <= 0 || p > 100 {
+		panic(fmt.Sprintf("Percentile [%v] should be in range (0, 100]", p))
+	}
+	return func(s *baseStage) {
+		s.thresholds = append(s.thresholds, threshold{
+			check: fmt.Sprintf("latency_p%v_us", p),
+			limit: float64(max.Microseconds()),
+			actual: func(snapshot stats.Snapshot) float64 {
+				v, _ := snapshot.Latency().Percentile(p)
+				return float64(v.Microseconds())
+			},
+		})
+	}
+}
+
+// WithErrorRateThreshold fails the stage verdict when the share of failed executions exceeds rate.
+// HTTP runnables fail executions on 5xx responses, and on 4xx ones with runnables.WithFail4xx.
+func WithErrorRateThreshold(rate float64) StageOption {
+	if rate < 0 || rate > 1 {
+		panic("Error rate should be in range [0, 1]")
+	}
+	return func(s *baseStage) {
+		s.thresholds = append(s.thresholds, threshold{
+			check: "error_rate",
+			limit: rate,
+			actual: func(snapshot stats.Snapshot) float64 {
+				return snapshot.ErrorRate()
+			},
+		})
+	}
+}
+
+func (s *baseStage) verdicts(snapshot stats.Snapshot) []results.Verdict {
+	verdicts := make([]results.Verdict, 0, len(s.thresholds))
+	for _, t := range s.thresholds {
+		actual := t.actual(snapshot)
+		verdicts = append(verdicts, results.Verdict{
+			Check:     t.check,
+			Threshold: t.limit,
+			Actual:    actual,
+			Passed:    actual <= t.limit,
+		})
+	}
+	return verdicts
+}
+
+func formatVerdicts(verdicts []results.Verdict) string {
+	var formatted string
+	for _, v := range verdicts {
+		status := "PASSED"
+		if !v.Passed {
+			status = "FAILED"
+		}
+		formatted += fmt.Sprintf("%v: %v, threshold: [%v], actual: [%v]\n", status, v.Check, v.Threshold, v.Actual)
+	}
+	return formatted
+}
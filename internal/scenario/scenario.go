@@ -0,0 +1,582 @@
+package scenario
+
+import (
+	"aggressive-pokes/internal/capture"
+	"aggressive-pokes/internal/ltlogger"
+	"aggressive-pokes/internal/results"
+	"aggressive-pokes/internal/runnables"
+	"aggressive-pokes/internal/runner"
+	"aggressive-pokes/internal/sinks"
+	"aggressive-pokes/internal/stats"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Scenario is a JSON description of a load test, so tests can be submitted without touching the code.
+type Scenario struct {
+	Name       string   `json:"name,omitempty"`
+	Target     Target   `json:"target"`
+	Stages     []Stage  `json:"stages"`
+	ResultsDir string   `json:"results_dir,omitempty"` // local scenarios only, the API rejects it and uses the dir of the server
+	Sinks      []Sink   `json:"sinks,omitempty"`
+	Capture    *Capture `json:"capture,omitempty"`
+}
+
+// Capture saves failed requests of http targets, i.e. transport errors and non-2xx responses,
+// along with a sample of successful ones into rotating JSONL files.
+type Capture struct {
+	Dir           string   `json:"dir"`
+	SamplePercent float64  `json:"sample_percent,omitempty"` // successful requests to capture, in range [0, 100]
+	MaxBody       int      `json:"max_body,omitempty"`       // bytes of a body to keep
+	MaxFileSize   int64    `json:"max_file_size,omitempty"`  // bytes after which a new file is started
+	MaxFiles      int      `json:"max_files,omitempty"`      // files kept, the oldest are deleted
+	Redact        []string `json:"redact,omitempty"`         // headers to redact on top of capture.DefaultRedact
+}
+
+// Sink streams per interval metrics of the run to a time-series backend.
+type Sink struct {
+	Type     string   `json:"type"`              // influx, influx-udp, statsd, graphite or file
+	URL      string   `json:"url,omitempty"`     // influx write endpoint, e.g. http://localhost:8086/api/v2/write?org=o&bucket=b
+	Token    string   `json:"token,omitempty"`   // influx API token
+	Address  string   `json:"address,omitempty"` // host:port of udp and tcp backends
+	Path     string   `json:"path,omitempty"`    // file the influx line protocol is appended to
+	Prefix   string   `json:"prefix,omitempty"`  // measurement for influx, metric prefix otherwise
+	Interval Duration `json:"interval,omitempty"`
+}
+
+type Target struct {
+	Type    string            `json:"type"`              // http, stream, graphql, pubsub, grpc or websocket
+	Method  string            `json:"method,omitempty"`  // e.g. helloworld.Greeter/SayHello for grpc
+	URL     string            `json:"url,omitempty"`     // host:port for grpc
+	Body    string            `json:"body,omitempty"`    // JSON request message template for grpc
+	Headers map[string]string `json:"headers,omitempty"` // metadata for grpc
+	Project string            `json:"project,omitempty"`
+	Topic   string            `json:"topic,omitempty"`
+	// Tags are attached to every execution of the target, e.g. {"region": "eu"}
+	Tags   stats.Tags `json:"tags,omitempty"`
+	Client *Client    `json:"client,omitempty"`
+	// Fail4xx counts 4xx responses of http targets as failures, 5xx responses always are
+	Fail4xx bool `json:"fail_4xx,omitempty"`
+	// Endpoint tags executions of http targets by a route template, e.g. /users/{id}, they aren't tagged by URL path
+	Endpoint string `json:"endpoint,omitempty"`
+	Grpc     *Grpc  `json:"grpc,omitempty"`
+	// WebSocket scripts sessions of websocket targets, each execution being a session of a virtual user
+	WebSocket *WebSocket `json:"websocket,omitempty"`
+	// Stream tells how stream targets, which are http targets keeping responses open, read events
+	Stream *Stream `json:"stream,omitempty"`
+	// GraphQL is the operation graphql targets post to url
+	GraphQL *GraphQL `json:"graphql,omitempty"`
+}
+
+type GraphQL struct {
+	Query          string `json:"query"`
+	OperationName  string `json:"operation_name,omitempty"`
+	Variables      string `json:"variables,omitempty"`       // JSON object template, e.g. {"id": "{{ uuid }}"}
+	PersistedQuery bool   `json:"persisted_query,omitempty"` // sends the sha256 hash of the query, the query itself only when unknown
+	MaxResponse    int    `json:"max_response,omitempty"`    // bytes of the response kept for parsing, 10MB by default
+}
+
+type Stream struct {
+	Format            string   `json:"format,omitempty"` // sse or lines, picked by the content type unless set
+	Until             string   `json:"until,omitempty"`  // regexp of the last event, e.g. \\[DONE\\]
+	MaxDuration       Duration `json:"max_duration,omitempty"`
+	FirstEventTimeout Duration `json:"first_event_timeout,omitempty"`
+	Endless           bool     `json:"endless,omitempty"` // the server ending the stream is a disconnect
+}
+
+type WebSocket struct {
+	Origin         string          `json:"origin,omitempty"`
+	Subprotocols   []string        `json:"subprotocols,omitempty"`
+	Script         []WebSocketStep `json:"script,omitempty"`
+	HoldFor        Duration        `json:"hold_for,omitempty"`     // connection lifetime
+	RepeatEvery    Duration        `json:"repeat_every,omitempty"` // reruns the script while holding
+	ConnectTimeout Duration        `json:"connect_timeout,omitempty"`
+	TLS            *TLS            `json:"tls,omitempty"`
+}
+
+type WebSocketStep struct {
+	Name    string   `json:"name,omitempty"`
+	Send    string   `json:"send,omitempty"`   // message template, {{ .session }} is an id of the session
+	Expect  string   `json:"expect,omitempty"` // regexp the reply must match
+	Timeout Duration `json:"timeout,omitempty"`
+}
+
+// Grpc tells where descriptors of grpc targets come from, server reflection unless set, and how to connect.
+type Grpc struct {
+	DescriptorSet string   `json:"descriptor_set,omitempty"` // written by protoc --include_imports --descriptor_set_out
+	Proto         string   `json:"proto,omitempty"`          // compiled by protoc on PATH
+	ImportPaths   []string `json:"import_paths,omitempty"`
+	Plaintext     bool     `json:"plaintext,omitempty"`
+	Timeout       Duration `json:"timeout,omitempty"` // deadline of each call, 5s by default
+	TLS           *TLS     `json:"tls,omitempty"`
+}
+
+// Client tunes the client of http targets, omitted fields keep the defaults.
+type Client struct {
+	Timeout               Duration `json:"timeout,omitempty"` // whole request including the body, 30s by default
+	ConnectTimeout        Duration `json:"connect_timeout,omitempty"`
+	TLSHandshakeTimeout   Duration `json:"tls_handshake_timeout,omitempty"`
+	ResponseHeaderTimeout Duration `json:"response_header_timeout,omitempty"`
+	DisableKeepAlives     bool     `json:"disable_keep_alives,omitempty"`
+	TCPKeepAlive          Duration `json:"tcp_keep_alive,omitempty"` // interval of probes, negative disables them
+	MaxConnsPerHost       int      `json:"max_conns_per_host,omitempty"`
+	MaxIdleConnsPerHost   int      `json:"max_idle_conns_per_host,omitempty"`
+	NewClientPerRequest   bool     `json:"new_client_per_request,omitempty"` // simulates distinct clients instead of one pooled
+	DNSCacheTTL           Duration `json:"dns_cache_ttl,omitempty"`
+	LocalAddr             string   `json:"local_addr,omitempty"` // source IP
+	Proxy                 string   `json:"proxy,omitempty"`      // proxy URL, or env to use HTTP_PROXY and friends
+	TLS                   *TLS     `json:"tls,omitempty"`
+	Protocol              string   `json:"protocol,omitempty"`               // http1, http2 or h2c, https negotiates HTTP/2 or HTTP/1.1 by default
+	MaxConcurrentStreams  int      `json:"max_concurrent_streams,omitempty"` // per HTTP/2 connection, see max_conns_per_host for connections
+}
+
+// LocalFiles lists fields which read or write files of the machine running the scenario, or run programs on it.
+func (s *Scenario) LocalFiles() []string {
+	var fields []string
+	if s.ResultsDir != "" {
+		fields = append(fields, "results_dir")
+	}
+	if s.Capture != nil && s.Capture.Dir != "" {
+		fields = append(fields, "capture.dir")
+	}
+	for i, sink := range s.Sinks {
+		if sink.Path != "" {
+			fields = append(fields, fmt.Sprintf("sinks[%v].path", i))
+		}
+	}
+	t := s.Target
+	if t.Grpc != nil {
+		if t.Grpc.DescriptorSet != "" {
+			fields = append(fields, "target.grpc.descriptor_set")
+		}
+		if t.Grpc.Proto != "" {
+			fields = append(fields, "target.grpc.proto")
+		}
+		if len(t.Grpc.ImportPaths) > 0 {
+			fields = append(fields, "target.grpc.import_paths")
+		}
+		fields = append(fields, t.Grpc.TLS.localFiles("target.grpc.tls")...)
+	}
+	if t.Client != nil {
+		fields = append(fields, t.Client.TLS.localFiles("target.client.tls")...)
+	}
+	if t.WebSocket != nil {
+		fields = append(fields, t.WebSocket.TLS.localFiles("target.websocket.tls")...)
+	}
+	return fields
+}
+
+// TLS configures TLS of http targets, certificates and keys are paths of PEM files.
+type TLS struct {
+	CA                 string   `json:"ca,omitempty"` // trusted on top of the system roots
+	Cert               string   `json:"cert,omitempty"`
+	Key                string   `json:"key,omitempty"`
+	InsecureSkipVerify bool     `json:"insecure_skip_verify,omitempty"`
+	ServerName         string   `json:"server_name,omitempty"` // SNI override
+	MinVersion         string   `json:"min_version,omitempty"` // e.g. 1.2
+	MaxVersion         string   `json:"max_version,omitempty"`
+	CipherSuites       []string `json:"cipher_suites,omitempty"` // e.g. TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256
+}
+
+func (t *TLS) localFiles(prefix string) []string {
+	if t == nil {
+		return nil
+	}
+	var fields []string
+	for name, path := range map[string]string{"ca": t.CA, "cert": t.Cert, "key": t.Key} {
+		if path != "" {
+			fields = append(fields, prefix+"."+name)
+		}
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+type Stage struct {
+	Type        string     `json:"type"` // qps or absolute
+	Qps         int        `json:"qps,omitempty"`
+	Duration    Duration   `json:"duration,omitempty"`
+	Amount      int        `json:"amount,omitempty"`
+	AsyncFactor int        `json:"async_factor,omitempty"`
+	Warmup      Duration   `json:"warmup,omitempty"`
+	Cooldown    Duration   `json:"cooldown,omitempty"`
+	Window      Duration   `json:"window,omitempty"`
+	Percentiles []float64  `json:"percentiles,omitempty"`
+	Thresholds  Thresholds `json:"thresholds,omitempty"`
+	// Tags are attached to every execution of the stage on top of target tags
+	Tags stats.Tags `json:"tags,omitempty"`
+	// GroupBy lists tags the stage summary is grouped by, "reason" by default
+	GroupBy []string `json:"group_by,omitempty"`
+}
+
+type Thresholds struct {
+	ErrorRate *float64 `json:"error_rate,omitempty"`
+	// Latency maps a percentile, e.g. "99", to the max allowed latency
+	Latency map[string]Duration `json:"latency,omitempty"`
+}
+
+// Duration is a time.Duration represented as a string like "1m30s" in JSON.
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+func Parse(r io.Reader) (Scenario, error) {
+	var s Scenario
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&s); err != nil {
+		return Scenario{}, fmt.Errorf("decode scenario: %w", err)
+	}
+	if len(s.Stages) == 0 {
+		return Scenario{}, errors.New("scenario has no stages")
+	}
+	return s, nil
+}
+
+// Build creates the load test described by the scenario.
+func (s Scenario) Build(logger ltlogger.Logger) (lt *runner.LoadTest, err error) {
+	test := runner.NewLoadTest()
+	// stage constructors panic on invalid config, sinks and captures built until then are released
+	defer func() {
+		if p := recover(); p != nil {
+			lt, err = nil, fmt.Errorf("invalid scenario: %v", p)
+		}
+		if err != nil {
+			test.Close()
+		}
+	}()
+
+	var capturer *capture.Capturer
+	if s.Capture != nil {
+		if capturer, err = s.Capture.build(logger); err != nil {
+			return nil, fmt.Errorf("capture: %w", err)
+		}
+		test.AddCapture(capturer)
+	}
+	runnable, err := s.Target.runnable(logger, capturer)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.Name != "" {
+		test.SetName(s.Name)
+	}
+	test.SetTarget(s.Target.result())
+	for i, stage := range s.Stages {
+		opts, err := stage.options()
+		if err != nil {
+			return nil, fmt.Errorf("stage [%v]: %w", i+1, err)
+		}
+		if len(s.Target.Tags) > 0 {
+			opts = append([]runner.StageOption{runner.WithTags(s.Target.Tags)}, opts...)
+		}
+		switch stage.Type {
+		case "qps":
+			test.AddQpsStage(stage.Qps, time.Duration(stage.Duration), runnable, opts...)
+		case "absolute":
+			test.AddAbsoluteStage(stage.Amount, stage.AsyncFactor, runnable, opts...)
+		default:
+			return nil, fmt.Errorf("stage [%v]: unknown type [%v]", i+1, stage.Type)
+		}
+	}
+	if s.ResultsDir != "" {
+		test.ExportResults(s.ResultsDir)
+	}
+	for i, sink := range s.Sinks {
+		built, err := sink.build(logger)
+		if err != nil {
+			return nil, fmt.Errorf("sink [%v]: %w", i+1, err)
+		}
+		test.AddSink(built)
+	}
+	return &test, nil
+}
+
+func (s Sink) build(logger ltlogger.Logger) (*sinks.Sink, error) {
+	prefix := s.Prefix
+	if prefix == "" {
+		prefix = "pokes"
+	}
+	interval := time.Duration(s.Interval)
+
+	switch s.Type {
+	case "influx":
+		if s.URL == "" {
+			return nil, errors.New("influx sink requires url")
+		}
+		var headers map[string]string
+		if s.Token != "" {
+			headers = map[string]string{"Authorization": "Token " + s.Token}
+		}
+		return sinks.New(logger, s.Type, sinks.Influx{Measurement: prefix}, sinks.NewHTTP(s.URL, headers), interval), nil
+	case "influx-udp", "statsd":
+		if s.Address == "" {
+			return nil, fmt.Errorf("%v sink requires address", s.Type)
+		}
+		transport, err := sinks.NewUDP(s.Address)
+		if err != nil {
+			return nil, err
+		}
+		var encoder sinks.Encoder = sinks.StatsD{Prefix: prefix}
+		if s.Type == "influx-udp" {
+			encoder = sinks.Influx{Measurement: prefix}
+		}
+		return sinks.New(logger, s.Type, encoder, transport, interval), nil
+	case "graphite":
+		if s.Address == "" {
+			return nil, errors.New("graphite sink requires address")
+		}
+		return sinks.New(logger, s.Type, sinks.Graphite{Prefix: prefix}, sinks.NewTCP(s.Address), interval), nil
+	case "file":
+		if s.Path == "" {
+			return nil, errors.New("file sink requires path")
+		}
+		transport, err := sinks.NewFile(s.Path)
+		if err != nil {
+			return nil, err
+		}
+		return sinks.New(logger, s.Type, sinks.Influx{Measurement: prefix}, transport, interval), nil
+	default:
+		return nil, fmt.Errorf("unknown sink type [%v]", s.Type)
+	}
+}
+
+func (c Capture) build(logger ltlogger.Logger) (*capture.Capturer, error) {
+	if c.SamplePercent < 0 || c.SamplePercent > 100 {
+		return nil, fmt.Errorf("sample_percent [%v] should be in range [0, 100]", c.SamplePercent)
+	}
+	return capture.New(logger, capture.Config{
+		Dir:         c.Dir,
+		SampleRate:  c.SamplePercent / 100,
+		MaxBody:     c.MaxBody,
+		MaxFileSize: c.MaxFileSize,
+		MaxFiles:    c.MaxFiles,
+		Redact:      c.Redact,
+	})
+}
+
+func (c Client) config() runnables.HttpClientConfig {
+	config := runnables.HttpClientConfig{
+		Timeout:               time.Duration(c.Timeout),
+		ConnectTimeout:        time.Duration(c.ConnectTimeout),
+		TLSHandshakeTimeout:   time.Duration(c.TLSHandshakeTimeout),
+		ResponseHeaderTimeout: time.Duration(c.ResponseHeaderTimeout),
+		DisableKeepAlives:     c.DisableKeepAlives,
+		TCPKeepAlive:          time.Duration(c.TCPKeepAlive),
+		MaxConnsPerHost:       c.MaxConnsPerHost,
+		MaxIdleConnsPerHost:   c.MaxIdleConnsPerHost,
+		NewClientPerRequest:   c.NewClientPerRequest,
+		DNSCacheTTL:           time.Duration(c.DNSCacheTTL),
+		LocalAddr:             c.LocalAddr,
+		Proxy:                 c.Proxy,
+		Protocol:              c.Protocol,
+		MaxConcurrentStreams:  c.MaxConcurrentStreams,
+	}
+	if c.TLS != nil {
+		config.TLS = c.TLS.config()
+	}
+	return config
+}
+
+func (t TLS) config() runnables.TLSConfig {
+	return runnables.TLSConfig{
+		CAFile:             t.CA,
+		CertFile:           t.Cert,
+		KeyFile:            t.Key,
+		InsecureSkipVerify: t.InsecureSkipVerify,
+		ServerName:         t.ServerName,
+		MinVersion:         t.MinVersion,
+		MaxVersion:         t.MaxVersion,
+		CipherSuites:       t.CipherSuites,
+	}
+}
+
+// runnable builds the target, capturer is nil unless the scenario captures requests.
+// result describes the target in run results, credentials in the url are redacted.
+func (t Target) result() results.Target {
+	target := results.Target{Type: t.Type, URL: t.URL, Method: t.Method}
+	switch t.Type {
+	case "http", "stream":
+		if target.Method == "" {
+			target.Method = http.MethodGet
+		}
+	case "graphql":
+		target.Method = http.MethodPost
+	case "pubsub":
+		target.URL = fmt.Sprintf("projects/%v/topics/%v", t.Project, t.Topic)
+	}
+	if u, err := url.Parse(target.URL); err == nil && u.User != nil {
+		target.URL = u.Redacted()
+	}
+	return target
+}
+
+func (t Target) runnable(logger ltlogger.Logger, capturer *capture.Capturer) (func(reporter stats.Reporter), error) {
+	switch t.Type {
+	case "http", "stream":
+		if t.URL == "" {
+			return nil, fmt.Errorf("%v target requires url", t.Type)
+		}
+		method := t.Method
+		if method == "" {
+			method = http.MethodGet
+		}
+		opts, err := t.httpOptions(capturer)
+		if err != nil {
+			return nil, err
+		}
+		supplier := runnables.NewHttpRequestSupplier(logger, method, t.URL, []byte(t.Body), t.Headers, nil)
+		if t.Type == "http" {
+			return runnables.HttpRunnableWithSupplier(supplier, opts...), nil
+		}
+		var config runnables.StreamConfig
+		if t.Stream != nil {
+			config = runnables.StreamConfig{
+				Format:            t.Stream.Format,
+				Until:             t.Stream.Until,
+				MaxDuration:       time.Duration(t.Stream.MaxDuration),
+				FirstEventTimeout: time.Duration(t.Stream.FirstEventTimeout),
+				Endless:           t.Stream.Endless,
+			}
+		}
+		if err := config.Validate(); err != nil {
+			return nil, fmt.Errorf("stream: %w", err)
+		}
+		return runnables.StreamRunnable(supplier, config, opts...), nil
+	case "graphql":
+		if t.GraphQL == nil {
+			return nil, errors.New("graphql target requires graphql")
+		}
+		opts, err := t.httpOptions(capturer)
+		if err != nil {
+			return nil, err
+		}
+		return runnables.GraphQLRunnable(logger, runnables.GraphQLConfig{
+			URL:            t.URL,
+			Query:          t.GraphQL.Query,
+			OperationName:  t.GraphQL.OperationName,
+			Variables:      t.GraphQL.Variables,
+			Headers:        t.Headers,
+			PersistedQuery: t.GraphQL.PersistedQuery,
+			MaxResponse:    t.GraphQL.MaxResponse,
+		}, opts...)
+	case "pubsub":
+		if t.Project == "" || t.Topic == "" {
+			return nil, errors.New("pubsub target requires project and topic")
+		}
+		return runnables.PubsubRunnable(logger, t.Project, t.Topic, []byte(t.Body))
+	case "grpc":
+		config := runnables.GrpcConfig{Address: t.URL, Method: t.Method, Body: t.Body, Metadata: t.Headers}
+		if t.Grpc != nil {
+			config.DescriptorSet, config.ProtoFile, config.ImportPaths = t.Grpc.DescriptorSet, t.Grpc.Proto, t.Grpc.ImportPaths
+			config.Plaintext, config.Timeout = t.Grpc.Plaintext, time.Duration(t.Grpc.Timeout)
+			if t.Grpc.TLS != nil {
+				config.TLS = t.Grpc.TLS.config()
+			}
+		}
+		return runnables.GrpcRunnable(logger, config)
+	case "websocket":
+		config := runnables.WebSocketConfig{URL: t.URL, Headers: t.Headers}
+		if ws := t.WebSocket; ws != nil {
+			config.Origin, config.Subprotocols = ws.Origin, ws.Subprotocols
+			config.HoldFor, config.RepeatEvery = time.Duration(ws.HoldFor), time.Duration(ws.RepeatEvery)
+			config.ConnectTimeout = time.Duration(ws.ConnectTimeout)
+			for _, step := range ws.Script {
+				config.Script = append(config.Script, runnables.WebSocketStep{
+					Name:    step.Name,
+					Send:    step.Send,
+					Expect:  step.Expect,
+					Timeout: time.Duration(step.Timeout),
+				})
+			}
+			if ws.TLS != nil {
+				config.TLS = ws.TLS.config()
+			}
+		}
+		return runnables.WebSocketRunnable(logger, config)
+	default:
+		return nil, fmt.Errorf("unknown target type [%v]", t.Type)
+	}
+}
+
+// httpOptions apply to targets over HTTP, capturer is nil unless the scenario captures requests.
+func (t Target) httpOptions(capturer *capture.Capturer) ([]runnables.HttpOption, error) {
+	var opts []runnables.HttpOption
+	if capturer != nil {
+		opts = append(opts, runnables.WithCapture(capturer))
+	}
+	if t.Fail4xx {
+		opts = append(opts, runnables.WithFail4xx())
+	}
+	if t.Endpoint != "" {
+		opts = append(opts, runnables.WithEndpoint(t.Endpoint))
+	}
+	if t.Client != nil {
+		config := t.Client.config()
+		if err := config.Validate(); err != nil {
+			return nil, fmt.Errorf("client: %w", err)
+		}
+		opts = append(opts, runnables.WithClient(config))
+	}
+	return opts, nil
+}
+
+func (s Stage) options() ([]runner.StageOption, error) {
+	var opts []runner.StageOption
+	if s.Warmup > 0 {
+		opts = append(opts, runner.WithWarmup(time.Duration(s.Warmup)))
+	}
+	if s.Cooldown > 0 {
+		opts = append(opts, runner.WithCooldown(time.Duration(s.Cooldown)))
+	}
+	if s.Window > 0 {
+		opts = append(opts, runner.WithWindow(time.Duration(s.Window)))
+	}
+	if len(s.Percentiles) > 0 {
+		opts = append(opts, runner.WithPercentiles(s.Percentiles...))
+	}
+	if len(s.Tags) > 0 {
+		opts = append(opts, runner.WithTags(s.Tags))
+	}
+	if len(s.GroupBy) > 0 {
+		opts = append(opts, runner.WithGroupBy(s.GroupBy...))
+	}
+	if s.Thresholds.ErrorRate != nil {
+		opts = append(opts, runner.WithErrorRateThreshold(*s.Thresholds.ErrorRate))
+	}
+	percentiles := make([]string, 0, len(s.Thresholds.Latency))
+	for p := range s.Thresholds.Latency {
+		percentiles = append(percentiles, p)
+	}
+	sort.Strings(percentiles)
+	for _, p := range percentiles {
+		percentile, err := strconv.ParseFloat(p, 64)
+		if err != nil {
+			return nil, fmt.Errorf("latency threshold percentile [%v]: %w", p, err)
+		}
+		opts = append(opts, runner.WithLatencyThreshold(percentile, time.Duration(s.Thresholds.Latency[p])))
+	}
+	return opts, nil
+}
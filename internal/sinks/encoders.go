@@ -0,0 +1,132 @@
+package sinks
+
+import (
+	"aggressive-pokes/internal/stats"
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// percentiles are sent for every point on top of mean and max latency.
+var percentiles = []float64{50, 90, 99}
+
+// Influx encodes points in the InfluxDB line protocol, one line per point of the given measurement.
+type Influx struct {
+	Measurement string
+}
+
+var (
+	influxMeasurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `)
+	influxTagEscaper         = strings.NewReplacer(",", `\,`, " ", `\ `, "=", `\=`)
+)
+
+func (e Influx) Encode(buf *bytes.Buffer, points []Point) {
+	for _, p := range points {
+		fmt.Fprintf(buf, "%v,scenario=%v,stage=%v,reason=%v%v count=%vi,errors=%vi,sent_bytes=%vi,received_bytes=%vi,mean_us=%vi,max_us=%vi",
+			influxMeasurementEscaper.Replace(e.Measurement),
+			influxTagEscaper.Replace(tagValue(p.Scenario)), p.Stage, influxTagEscaper.Replace(tagValue(p.Reason)),
+			influxTags(p.Tags), p.Count, p.Errors, p.Sent, p.Received, p.Latency.Mean().Microseconds(), p.Latency.Max().Microseconds())
+		for _, pct := range percentiles {
+			v, _ := p.Latency.Percentile(pct)
+			fmt.Fprintf(buf, ",p%v_us=%vi", pct, v.Microseconds())
+		}
+		fmt.Fprintf(buf, " %v\n", p.Time.UnixNano())
+	}
+}
+
+// influxTags renders tags as extra tag pairs, sorted by name as the line protocol recommends.
+func influxTags(tags stats.Tags) string {
+	var b strings.Builder
+	for _, name := range tags.Names() {
+		b.WriteString(",")
+		b.WriteString(influxTagEscaper.Replace(name))
+		b.WriteString("=")
+		b.WriteString(influxTagEscaper.Replace(tagValue(tags[name])))
+	}
+	return b.String()
+}
+
+// StatsD encodes counts as counters and latencies as gauges in milliseconds, aggregated over the sink interval.
+type StatsD struct {
+	Prefix string
+}
+
+func (e StatsD) Encode(buf *bytes.Buffer, points []Point) {
+	for _, p := range points {
+		name := metricPath(e.Prefix, p)
+		fmt.Fprintf(buf, "%v.count:%v|c\n", name, p.Count)
+		fmt.Fprintf(buf, "%v.errors:%v|c\n", name, p.Errors)
+		fmt.Fprintf(buf, "%v.sent_bytes:%v|c\n", name, p.Sent)
+		fmt.Fprintf(buf, "%v.received_bytes:%v|c\n", name, p.Received)
+		fmt.Fprintf(buf, "%v.mean_ms:%v|g\n", name, millis(p.Latency.Mean()))
+		fmt.Fprintf(buf, "%v.max_ms:%v|g\n", name, millis(p.Latency.Max()))
+		for _, pct := range percentiles {
+			v, _ := p.Latency.Percentile(pct)
+			fmt.Fprintf(buf, "%v.p%v_ms:%v|g\n", name, pathSegment(formatFloat(pct)), millis(v))
+		}
+	}
+}
+
+// Graphite encodes points in the Graphite plaintext protocol.
+type Graphite struct {
+	Prefix string
+}
+
+func (e Graphite) Encode(buf *bytes.Buffer, points []Point) {
+	for _, p := range points {
+		name := metricPath(e.Prefix, p)
+		ts := p.Time.Unix()
+		fmt.Fprintf(buf, "%v.count %v %v\n", name, p.Count, ts)
+		fmt.Fprintf(buf, "%v.errors %v %v\n", name, p.Errors, ts)
+		fmt.Fprintf(buf, "%v.sent_bytes %v %v\n", name, p.Sent, ts)
+		fmt.Fprintf(buf, "%v.received_bytes %v %v\n", name, p.Received, ts)
+		fmt.Fprintf(buf, "%v.mean_ms %v %v\n", name, millis(p.Latency.Mean()), ts)
+		fmt.Fprintf(buf, "%v.max_ms %v %v\n", name, millis(p.Latency.Max()), ts)
+		for _, pct := range percentiles {
+			v, _ := p.Latency.Percentile(pct)
+			fmt.Fprintf(buf, "%v.p%v_ms %v %v\n", name, pathSegment(formatFloat(pct)), millis(v), ts)
+		}
+	}
+}
+
+// metricPath builds a dotted name, e.g. prefix.scenario.stage_1.200.method_GET.
+func metricPath(prefix string, p Point) string {
+	segments := []string{pathSegment(p.Scenario), fmt.Sprintf("stage_%v", p.Stage), pathSegment(tagValue(p.Reason))}
+	for _, name := range p.Tags.Names() {
+		segments = append(segments, pathSegment(name+"_"+tagValue(p.Tags[name])))
+	}
+	if prefix != "" {
+		segments = append([]string{prefix}, segments...)
+	}
+	return strings.Join(segments, ".")
+}
+
+// pathSegment replaces everything but letters, digits, dashes and underscores, dots would nest the metric.
+func pathSegment(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_':
+			return r
+		default:
+			return '_'
+		}
+	}, s)
+}
+
+// tagValue keeps empty reasons from producing invalid lines.
+func tagValue(s string) string {
+	if s == "" {
+		return "none"
+	}
+	return s
+}
+
+func millis(d time.Duration) string {
+	return formatFloat(float64(d) / float64(time.Millisecond))
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
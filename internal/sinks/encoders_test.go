@@ -0,0 +1,118 @@
+package sinks
+
+import (
+	"aggressive-pokes/internal/stats"
+	"bytes"
+	"testing"
+	"time"
+)
+
+// testPoint has a single latency value, so every percentile of it is exact.
+func testPoint() Point {
+	latency := stats.NewHistogram()
+	latency.Record(1500 * time.Microsecond)
+	latency.Record(1500 * time.Microsecond)
+	return Point{
+		Time:     time.Unix(1700000000, 0),
+		Scenario: "check out",
+		Stage:    1,
+		Reason:   "200",
+		Tags:     stats.Tags{"region": "eu west", "method": "GET"},
+		Count:    2,
+		Errors:   1,
+		Latency:  latency,
+		Sent:     100,
+		Received: 2048,
+	}
+}
+
+func encode(e Encoder, points ...Point) string {
+	buf := &bytes.Buffer{}
+	e.Encode(buf, points)
+	return buf.String()
+}
+
+func TestInfluxEncode(t *testing.T) {
+	noReason := testPoint()
+	noReason.Reason, noReason.Tags = "", nil
+
+	got := encode(Influx{Measurement: "load test"}, testPoint(), noReason)
+	want := `load\ test,scenario=check\ out,stage=1,reason=200,method=GET,region=eu\ west count=2i,errors=1i,sent_bytes=100i,received_bytes=2048i,mean_us=1500i,max_us=1500i,p50_us=1500i,p90_us=1500i,p99_us=1500i 1700000000000000000
+load\ test,scenario=check\ out,stage=1,reason=none count=2i,errors=1i,sent_bytes=100i,received_bytes=2048i,mean_us=1500i,max_us=1500i,p50_us=1500i,p90_us=1500i,p99_us=1500i 1700000000000000000
+`
+	if got != want {
+		t.Errorf("got\n%v\nwant\n%v", got, want)
+	}
+}
+
+func TestStatsDEncode(t *testing.T) {
+	got := encode(StatsD{Prefix: "lt"}, testPoint())
+	want := `lt.check_out.stage_1.200.method_GET.region_eu_west.count:2|c
+lt.check_out.stage_1.200.method_GET.region_eu_west.errors:1|c
+lt.check_out.stage_1.200.method_GET.region_eu_west.sent_bytes:100|c
+lt.check_out.stage_1.200.method_GET.region_eu_west.received_bytes:2048|c
+lt.check_out.stage_1.200.method_GET.region_eu_west.mean_ms:1.5|g
+lt.check_out.stage_1.200.method_GET.region_eu_west.max_ms:1.5|g
+lt.check_out.stage_1.200.method_GET.region_eu_west.p50_ms:1.5|g
+lt.check_out.stage_1.200.method_GET.region_eu_west.p90_ms:1.5|g
+lt.check_out.stage_1.200.method_GET.region_eu_west.p99_ms:1.5|g
+`
+	if got != want {
+		t.Errorf("got\n%v\nwant\n%v", got, want)
+	}
+}
+
+func TestGraphiteEncode(t *testing.T) {
+	p := testPoint()
+	p.Tags = nil
+	got := encode(Graphite{}, p)
+	want := `check_out.stage_1.200.count 2 1700000000
+check_out.stage_1.200.errors 1 1700000000
+check_out.stage_1.200.sent_bytes 100 1700000000
+check_out.stage_1.200.received_bytes 2048 1700000000
+check_out.stage_1.200.mean_ms 1.5 1700000000
+check_out.stage_1.200.max_ms 1.5 1700000000
+check_out.stage_1.200.p50_ms 1.5 1700000000
+check_out.stage_1.200.p90_ms 1.5 1700000000
+check_out.stage_1.200.p99_ms 1.5 1700000000
+`
+	if got != want {
+		t.Errorf("got\n%v\nwant\n%v", got, want)
+	}
+}
+
+func TestInfluxTagEscaper(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{in: "plain", want: "plain"},
+		{in: "eu west", want: `eu\ west`},
+		{in: "a,b", want: `a\,b`},
+		{in: "k=v", want: `k\=v`},
+		{in: "a b,c=d", want: `a\ b\,c\=d`},
+	}
+	for _, tt := range tests {
+		if got := influxTagEscaper.Replace(tt.in); got != tt.want {
+			t.Errorf("influxTagEscaper(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestPathSegment(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{in: "checkout-v2_eu", want: "checkout-v2_eu"},
+		{in: "99.9", want: "99_9"},
+		{in: "/users/{id}", want: "_users__id_"},
+		{in: "check out", want: "check_out"},
+		{in: "zürich", want: "z_rich"},
+	}
+	for _, tt := range tests {
+		if got := pathSegment(tt.in); got != tt.want {
+			t.Errorf("pathSegment(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,239 @@
+package sinks
+
+import (
+	"aggressive-pokes/internal/ltlogger"
+	"aggressive-pokes/internal/stats"
+	"bytes"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	DefaultInterval = 10 * time.Second
+	// eventBuffer bounds reports waiting for aggregation, reports beyond it are dropped rather than blocking
+	eventBuffer = 1 << 16
+	// payloadBuffer bounds encoded intervals waiting for a slow backend
+	payloadBuffer = 16
+	// closeTimeout bounds how long Close waits for pending payloads
+	closeTimeout = 15 * time.Second
+)
+
+// Sink aggregates reports into points per interval and streams them to a backend in background, never blocking.
+type Sink struct {
+	name      string
+	logger    ltlogger.Logger
+	encoder   Encoder
+	transport Transport
+	interval  time.Duration
+	events    chan event
+	payloads  chan []byte
+	dropped   atomic.Uint64
+	// stop ends aggregation, events is never closed as stage sinks may still be recording, e.g. from parallel runnables
+	stop      chan struct{}
+	closed    atomic.Bool
+	done      chan struct{}
+	closeOnce *sync.Once
+}
+
+// Point is the aggregate of a single reason and tags of a stage over an interval.
+type Point struct {
+	Time     time.Time
+	Scenario string
+	Stage    int
+	Reason   string
+	Tags     stats.Tags
+	Count    uint64
+	Errors   uint64
+	Latency  *stats.Histogram
+	Sent     int64 // wire bytes
+	Received int64
+}
+
+// Encoder renders interval points in the wire format of a backend.
+type Encoder interface {
+	Encode(buf *bytes.Buffer, points []Point)
+}
+
+// Transport delivers encoded payloads, it's only ever called from the sink goroutine.
+type Transport interface {
+	Send(payload []byte) error
+	Close() error
+}
+
+type pointKey struct {
+	scenario string
+	stage    int
+	reason   string
+	tags     string // rendered by stats.Tags.Key, so the key stays comparable
+}
+
+type event struct {
+	key      pointKey
+	tags     stats.Tags
+	failed   bool
+	elapsed  time.Duration
+	sent     int64
+	received int64
+}
+
+func New(logger ltlogger.Logger, name string, encoder Encoder, transport Transport, interval time.Duration) *Sink {
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	s := &Sink{
+		name:      name,
+		logger:    logger,
+		encoder:   encoder,
+		transport: transport,
+		interval:  interval,
+		events:    make(chan event, eventBuffer),
+		payloads:  make(chan []byte, payloadBuffer),
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+		closeOnce: &sync.Once{},
+	}
+	go s.aggregate()
+	go s.send()
+	return s
+}
+
+// Stage returns the sink for executions of the given stage of a scenario.
+func (s *Sink) Stage(scenario string, stage int) stats.Sink {
+	return stageSink{sink: s, scenario: scenario, stage: stage}
+}
+
+type stageSink struct {
+	sink     *Sink
+	scenario string
+	stage    int
+}
+
+// Record drops executions reported once the sink was closed.
+func (s stageSink) Record(e stats.Execution) {
+	if s.sink.closed.Load() {
+		return
+	}
+	select {
+	case s.sink.events <- event{
+		key:      pointKey{scenario: s.scenario, stage: s.stage, reason: e.Reason, tags: e.TagsKey()},
+		tags:     e.Tags,
+		failed:   e.Failed,
+		elapsed:  e.Elapsed,
+		sent:     e.Sent.Wire(),
+		received: e.Received.Wire(),
+	}:
+	default:
+		s.sink.dropped.Add(1)
+	}
+}
+
+// Dropped counts reports and intervals the sink couldn't keep up with.
+func (s *Sink) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+// Close flushes the current interval and waits a while for pending payloads to be sent.
+func (s *Sink) Close() {
+	s.closeOnce.Do(func() {
+		s.closed.Store(true)
+		close(s.stop)
+		select {
+		case <-s.done:
+		case <-time.After(closeTimeout):
+			s.logger.Warn("Sink didn't flush in time, pending metrics are lost", "sink", s.name)
+			return
+		}
+		if err := s.transport.Close(); err != nil {
+			s.logger.Warn("Closing sink failed", "sink", s.name, "err", err)
+		}
+		if dropped := s.Dropped(); dropped > 0 {
+			s.logger.Warn("Sink couldn't keep up", "sink", s.name, "dropped", dropped)
+		}
+	})
+}
+
+func (s *Sink) aggregate() {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	defer close(s.payloads)
+
+	points := make(map[pointKey]*Point)
+	for {
+		select {
+		case e := <-s.events:
+			add(points, e)
+		case <-s.stop:
+			// takes in events recorded before the close, later ones are lost
+			for {
+				select {
+				case e := <-s.events:
+					add(points, e)
+				default:
+					s.flush(points, time.Now())
+					return
+				}
+			}
+		case now := <-ticker.C:
+			s.flush(points, now)
+			points = make(map[pointKey]*Point)
+		}
+	}
+}
+
+func add(points map[pointKey]*Point, e event) {
+	p, ok := points[e.key]
+	if !ok {
+		p = &Point{Scenario: e.key.scenario, Stage: e.key.stage, Reason: e.key.reason, Tags: e.tags, Latency: stats.NewHistogram()}
+		points[e.key] = p
+	}
+	p.Count++
+	if e.failed {
+		p.Errors++
+	}
+	p.Latency.Record(e.elapsed)
+	p.Sent += e.sent
+	p.Received += e.received
+}
+
+func (s *Sink) flush(points map[pointKey]*Point, now time.Time) {
+	if len(points) == 0 {
+		return
+	}
+	sorted := make([]Point, 0, len(points))
+	for _, p := range points {
+		p.Time = now
+		sorted = append(sorted, *p)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if a.Scenario != b.Scenario {
+			return a.Scenario < b.Scenario
+		}
+		if a.Stage != b.Stage {
+			return a.Stage < b.Stage
+		}
+		if a.Reason != b.Reason {
+			return a.Reason < b.Reason
+		}
+		return a.Tags.String() < b.Tags.String()
+	})
+
+	buf := &bytes.Buffer{}
+	s.encoder.Encode(buf, sorted)
+	select {
+	case s.payloads <- buf.Bytes():
+	default:
+		s.dropped.Add(1)
+	}
+}
+
+func (s *Sink) send() {
+	defer close(s.done)
+	for payload := range s.payloads {
+		if err := s.transport.Send(payload); err != nil {
+			s.logger.Warn("Sending metrics failed", "sink", s.name, "err", err)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package sinks
+
+import (
+	"aggressive-pokes/internal/ltlogger"
+	"aggressive-pokes/internal/stats"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memoryTransport keeps payloads sent to it.
+type memoryTransport struct {
+	payloads []string
+	mx       *sync.Mutex
+}
+
+func (t *memoryTransport) Send(payload []byte) error {
+	t.mx.Lock()
+	defer t.mx.Unlock()
+	t.payloads = append(t.payloads, string(payload))
+	return nil
+}
+
+func (t *memoryTransport) Close() error {
+	return nil
+}
+
+func (t *memoryTransport) lines() []string {
+	t.mx.Lock()
+	defer t.mx.Unlock()
+	return strings.Split(strings.TrimSpace(strings.Join(t.payloads, "")), "\n")
+}
+
+func TestSinkClose(t *testing.T) {
+	transport := &memoryTransport{mx: &sync.Mutex{}}
+	sink := New(ltlogger.New(false, "test", slog.LevelWarn), "test", Graphite{}, transport, time.Hour)
+	stage := sink.Stage("checkout", 1)
+	for i := 0; i < 3; i++ {
+		stage.Record(stats.Execution{Reason: "200", Elapsed: time.Millisecond})
+	}
+	// the interval is flushed on close, even though it didn't pass
+	sink.Close()
+	stage.Record(stats.Execution{Reason: "500", Elapsed: time.Millisecond})
+
+	lines := transport.lines()
+	if len(lines) == 0 || !strings.HasPrefix(lines[0], "checkout.stage_1.200.count 3 ") {
+		t.Fatalf("sent %q, want the count of the flushed interval first", lines)
+	}
+	for _, line := range lines {
+		if strings.Contains(line, ".500.") {
+			t.Errorf("sent %q, recorded after the sink was closed", line)
+		}
+	}
+	if sink.Dropped() != 0 {
+		t.Errorf("dropped %v reports, want 0", sink.Dropped())
+	}
+}
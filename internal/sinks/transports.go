@@ -0,0 +1,156 @@
+package sinks
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"time"
+)
+
+const (
+	sendTimeout = 10 * time.Second
+	// maxDatagram keeps UDP payloads below a typical MTU, lines are never split across datagrams
+	maxDatagram = 1400
+)
+
+// HTTP posts payloads to url, e.g. an InfluxDB write endpoint.
+type HTTP struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+}
+
+func NewHTTP(url string, headers map[string]string) *HTTP {
+	return &HTTP{
+		url:     url,
+		headers: headers,
+		client:  &http.Client{Timeout: sendTimeout},
+	}
+}
+
+func (t *HTTP) Send(payload []byte) error {
+	req, err := http.NewRequest(http.MethodPost, t.url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	for k, v := range t.headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status [%v]: %s", resp.StatusCode, body)
+	}
+	return nil
+}
+
+func (t *HTTP) Close() error {
+	t.client.CloseIdleConnections()
+	return nil
+}
+
+// UDP sends payloads as datagrams, e.g. to StatsD or the InfluxDB UDP listener.
+type UDP struct {
+	conn net.Conn
+}
+
+func NewUDP(addr string) (*UDP, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return &UDP{conn: conn}, nil
+}
+
+func (t *UDP) Send(payload []byte) error {
+	for len(payload) > 0 {
+		n := datagramSize(payload)
+		if _, err := t.conn.Write(payload[:n]); err != nil {
+			return err
+		}
+		payload = payload[n:]
+	}
+	return nil
+}
+
+// datagramSize is the length of the leading whole lines which fit a datagram.
+func datagramSize(payload []byte) int {
+	if len(payload) <= maxDatagram {
+		return len(payload)
+	}
+	if i := bytes.LastIndexByte(payload[:maxDatagram], '\n'); i >= 0 {
+		return i + 1
+	}
+	if i := bytes.IndexByte(payload, '\n'); i >= 0 {
+		return i + 1
+	}
+	return len(payload)
+}
+
+func (t *UDP) Close() error {
+	return t.conn.Close()
+}
+
+// TCP writes payloads over a connection which is reestablished whenever a write fails, e.g. to Graphite.
+type TCP struct {
+	addr string
+	conn net.Conn
+}
+
+func NewTCP(addr string) *TCP {
+	return &TCP{addr: addr}
+}
+
+func (t *TCP) Send(payload []byte) error {
+	if t.conn == nil {
+		conn, err := net.DialTimeout("tcp", t.addr, sendTimeout)
+		if err != nil {
+			return err
+		}
+		t.conn = conn
+	}
+	_ = t.conn.SetWriteDeadline(time.Now().Add(sendTimeout))
+	if _, err := t.conn.Write(payload); err != nil {
+		_ = t.conn.Close()
+		t.conn = nil
+		return err
+	}
+	return nil
+}
+
+func (t *TCP) Close() error {
+	if t.conn == nil {
+		return nil
+	}
+	return t.conn.Close()
+}
+
+// File appends payloads to a file, e.g. to import them into a backend later.
+type File struct {
+	f *os.File
+}
+
+func NewFile(path string) (*File, error) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &File{f: f}, nil
+}
+
+func (t *File) Send(payload []byte) error {
+	_, err := t.f.Write(payload)
+	return err
+}
+
+func (t *File) Close() error {
+	return t.f.Close()
+}
@@ -0,0 +1,28 @@
+package sinks
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDatagramSize(t *testing.T) {
+	line := strings.Repeat("x", 599) + "\n"
+	long := strings.Repeat("y", maxDatagram+100) + "\n"
+	tests := []struct {
+		name    string
+		payload string
+		want    int
+	}{
+		{name: "fits", payload: line + line, want: 2 * len(line)},
+		{name: "whole lines which fit", payload: line + line + line, want: 2 * len(line)},
+		{name: "first line too long", payload: long + line, want: len(long)},
+		{name: "single line too long", payload: strings.TrimSuffix(long, "\n"), want: len(long) - 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := datagramSize([]byte(tt.payload)); got != tt.want {
+				t.Errorf("datagramSize = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package stats
+
+import (
+	"fmt"
+	"time"
+)
+
+// Size is the amount of bytes an execution sent or received.
+type Size struct {
+	Headers int64
+	Body    int64 // as transferred, i.e. compressed when the payload was encoded
+	Decoded int64 // body after decoding, equals Body for payloads which weren't encoded
+}
+
+// Wire is the amount of bytes which went over the network.
+func (s Size) Wire() int64 {
+	return s.Headers + s.Body
+}
+
+func (s Size) add(other Size) Size {
+	return Size{
+		Headers: s.Headers + other.Headers,
+		Body:    s.Body + other.Body,
+		Decoded: s.Decoded + other.Decoded,
+	}
+}
+
+// SizeHistogram tracks sizes in bytes in the buckets of Histogram, a byte per microsecond.
+type SizeHistogram struct {
+	h *Histogram
+}
+
+func NewSizeHistogram() *SizeHistogram {
+	return &SizeHistogram{h: NewHistogram()}
+}
+
+func (s *SizeHistogram) Record(bytes int64) {
+	s.h.Record(time.Duration(bytes) * time.Microsecond)
+}
+
+func (s *SizeHistogram) Merge(other *SizeHistogram) {
+	if other == nil {
+		return
+	}
+	s.h.Merge(other.h)
+}
+
+func (s *SizeHistogram) Count() uint64 {
+	return s.h.Count()
+}
+
+func (s *SizeHistogram) Mean() int64 {
+	return s.h.Mean().Microseconds()
+}
+
+func (s *SizeHistogram) Max() int64 {
+	return s.h.Max().Microseconds()
+}
+
+func (s *SizeHistogram) Percentile(p float64) (int64, error) {
+	v, err := s.h.Percentile(p)
+	return v.Microseconds(), err
+}
+
+// Transfer aggregates sizes of executions in one direction, either sent or received.
+type Transfer struct {
+	Total Size
+	Sizes *SizeHistogram // wire sizes of single executions
+}
+
+func newTransfer() *Transfer {
+	return &Transfer{Sizes: NewSizeHistogram()}
+}
+
+func (t *Transfer) record(s Size) {
+	t.Total = t.Total.add(s)
+	t.Sizes.Record(s.Wire())
+}
+
+func (t *Transfer) merge(other *Transfer) {
+	t.Total = t.Total.add(other.Total)
+	t.Sizes.Merge(other.Sizes)
+}
+
+// Format renders the total and mean wire size, e.g. "12.5 MB, mean 1.2 KB".
+func (t *Transfer) Format() string {
+	return fmt.Sprintf("%v, mean %v", FormatBytes(t.Total.Wire()), FormatBytes(t.Sizes.Mean()))
+}
+
+// FormatBytes renders bytes in decimal units, e.g. "1.5 MB".
+func FormatBytes(bytes int64) string {
+	const unit = 1000
+	if bytes < unit {
+		return fmt.Sprintf("%v B", bytes)
+	}
+	value, exp := float64(bytes)/unit, 0
+	for value >= unit && exp < 4 {
+		value /= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", value, "kMGTP"[exp])
+}
@@ -0,0 +1,54 @@
+package stats
+
+import "fmt"
+
+// Events are messages of a streamed response, e.g. server-sent events or JSON lines.
+type Events struct {
+	Count int
+	// Gaps are times between consecutive events, the wait for the first one is a phase of the execution
+	Gaps *Histogram
+}
+
+// EventStats aggregate events of streamed executions.
+type EventStats struct {
+	Streams int
+	Count   int
+	Max     int // events of the longest stream
+	Gaps    *Histogram
+}
+
+func newEventStats() *EventStats {
+	return &EventStats{Gaps: NewHistogram()}
+}
+
+func (s *EventStats) record(e *Events) {
+	s.Streams++
+	s.Count += e.Count
+	s.Max = max(s.Max, e.Count)
+	s.Gaps.Merge(e.Gaps)
+}
+
+func (s *EventStats) merge(other *EventStats) {
+	s.Streams += other.Streams
+	s.Count += other.Count
+	s.Max = max(s.Max, other.Max)
+	s.Gaps.Merge(other.Gaps)
+}
+
+// PerStream is the mean of events per stream.
+func (s *EventStats) PerStream() float64 {
+	if s.Streams == 0 {
+		return 0
+	}
+	return float64(s.Count) / float64(s.Streams)
+}
+
+// Format renders events per stream, along with gaps once any stream had more than one event.
+func (s *EventStats) Format() string {
+	events := fmt.Sprintf("events/stream: %.1f (max %v)", s.PerStream(), s.Max)
+	if s.Gaps.Count() == 0 {
+		return events
+	}
+	p99, _ := s.Gaps.Percentile(99)
+	return fmt.Sprintf("%v | gap mean: %v | gap p99: %v | gap max: %v", events, s.Gaps.Mean(), p99, s.Gaps.Max())
+}
@@ -0,0 +1,167 @@
+package stats
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+	"sort"
+	"time"
+)
+
+const (
+	// 128 linear sub-buckets per power of two keep the relative error under 1%
+	histogramSubBucketBits = 7
+	histogramSubBuckets    = 1 << histogramSubBucketBits
+	histogramMaxValue      = int64(time.Hour / time.Microsecond)
+)
+
+// DefaultPercentiles are reported when a stage doesn't configure its own set.
+var DefaultPercentiles = []float64{50, 75, 90, 95, 99, 99.9}
+
+// Histogram is a latency histogram with log-linear buckets of microsecond precision.
+type Histogram struct {
+	counts map[int]uint64
+	total  uint64
+	sum    int64 // micros
+	min    int64 // micros
+	max    int64 // micros
+}
+
+func NewHistogram() *Histogram {
+	return &Histogram{
+		counts: make(map[int]uint64),
+		min:    math.MaxInt64,
+	}
+}
+
+func (h *Histogram) Record(d time.Duration) {
+	v := d.Microseconds()
+	if v < 0 {
+		v = 0
+	}
+	if v > histogramMaxValue {
+		v = histogramMaxValue
+	}
+
+	h.counts[bucketIndex(v)]++
+	h.total++
+	h.sum += v
+	if v < h.min {
+		h.min = v
+	}
+	if v > h.max {
+		h.max = v
+	}
+}
+
+func (h *Histogram) Merge(other *Histogram) {
+	if other == nil {
+		return
+	}
+	for i, c := range other.counts {
+		h.counts[i] += c
+	}
+	h.total += other.total
+	h.sum += other.sum
+	if other.min < h.min {
+		h.min = other.min
+	}
+	if other.max > h.max {
+		h.max = other.max
+	}
+}
+
+func (h *Histogram) Clone() *Histogram {
+	clone := NewHistogram()
+	clone.Merge(h)
+	return clone
+}
+
+func (h *Histogram) Count() uint64 {
+	return h.total
+}
+
+func (h *Histogram) Mean() time.Duration {
+	if h.total == 0 {
+		return 0
+	}
+	return time.Duration(h.sum/int64(h.total)) * time.Microsecond
+}
+
+func (h *Histogram) Min() time.Duration {
+	if h.total == 0 {
+		return 0
+	}
+	return time.Duration(h.min) * time.Microsecond
+}
+
+func (h *Histogram) Max() time.Duration {
+	return time.Duration(h.max) * time.Microsecond
+}
+
+// Percentile returns the value below which p percent of recorded values fall, p should be in range (0, 100].
+func (h *Histogram) Percentile(p float64) (time.Duration, error) {
+	if p <= 0 || p > 100 {
+		return 0, fmt.Errorf("percentile value [%v] out of bounds", p)
+	}
+	if h.total == 0 {
+		return 0, nil
+	}
+	if p == 100 {
+		return h.Max(), nil
+	}
+
+	indexes := make([]int, 0, len(h.counts))
+	for i := range h.counts {
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+
+	rank := uint64(math.Ceil(p / 100 * float64(h.total)))
+	var seen uint64
+	for _, i := range indexes {
+		seen += h.counts[i]
+		if seen >= rank {
+			v := bucketMidValue(i)
+			if v < h.min {
+				v = h.min
+			}
+			if v > h.max {
+				v = h.max
+			}
+			return time.Duration(v) * time.Microsecond, nil
+		}
+	}
+	return h.Max(), nil
+}
+
+// Percentiles resolves each of percentiles, in the same order.
+func (h *Histogram) Percentiles(percentiles ...float64) ([]time.Duration, error) {
+	result := make([]time.Duration, len(percentiles))
+	for i, p := range percentiles {
+		v, err := h.Percentile(p)
+		if err != nil {
+			return nil, err
+		}
+		result[i] = v
+	}
+	return result, nil
+}
+
+// bucketIndex maps values below 2*histogramSubBuckets exactly, larger ones by magnitude and leading bits.
+func bucketIndex(v int64) int {
+	if v < 2*histogramSubBuckets {
+		return int(v)
+	}
+	exp := bits.Len64(uint64(v)) - 1 - histogramSubBucketBits
+	return (exp+1)*histogramSubBuckets + int(v>>exp) - histogramSubBuckets
+}
+
+func bucketMidValue(i int) int64 {
+	if i < 2*histogramSubBuckets {
+		return int64(i)
+	}
+	exp := i/histogramSubBuckets - 1
+	sub := int64(i%histogramSubBuckets + histogramSubBuckets)
+	return sub<<exp + (int64(1)<<exp)/2
+}
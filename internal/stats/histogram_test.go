@@ -0,0 +1,153 @@
+package stats
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestBucketBounds(t *testing.T) {
+	tests := []struct {
+		name  string
+		value int64
+		index int
+		mid   int64
+	}{
+		{name: "zero", value: 0, index: 0, mid: 0},
+		{name: "exact below sub-buckets", value: 100, index: 100, mid: 100},
+		{name: "last exact", value: 255, index: 255, mid: 255},
+		{name: "first shared", value: 256, index: 256, mid: 257},
+		{name: "shares with first", value: 257, index: 256, mid: 257},
+		{name: "next shared", value: 258, index: 257, mid: 259},
+		{name: "next magnitude", value: 512, index: 384, mid: 514},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			i := bucketIndex(tt.value)
+			if i != tt.index {
+				t.Errorf("bucketIndex(%v) = %v, want %v", tt.value, i, tt.index)
+			}
+			if mid := bucketMidValue(i); mid != tt.mid {
+				t.Errorf("bucketMidValue(%v) = %v, want %v", i, mid, tt.mid)
+			}
+		})
+	}
+}
+
+func TestBucketRelativeError(t *testing.T) {
+	prev := -1
+	for v := int64(1); v <= histogramMaxValue; v = v*11/10 + 1 {
+		i := bucketIndex(v)
+		if i < prev {
+			t.Fatalf("bucketIndex(%v) = %v, below the index of a smaller value %v", v, i, prev)
+		}
+		prev = i
+		if err := math.Abs(float64(bucketMidValue(i)-v)) / float64(v); err > 0.01 {
+			t.Errorf("value %v lands in a bucket with mid value %v, %.2f%% off", v, bucketMidValue(i), err*100)
+		}
+	}
+}
+
+// linearHistogram records every microsecond from from to to.
+func linearHistogram(from, to int) *Histogram {
+	h := NewHistogram()
+	for v := from; v <= to; v++ {
+		h.Record(time.Duration(v) * time.Microsecond)
+	}
+	return h
+}
+
+func TestPercentile(t *testing.T) {
+	h := linearHistogram(1, 1000)
+	tests := []struct {
+		p    float64
+		want time.Duration
+		err  bool
+	}{
+		{p: 0, err: true},
+		{p: -1, err: true},
+		{p: 100.1, err: true},
+		{p: 50, want: 500 * time.Microsecond},
+		{p: 99, want: 990 * time.Microsecond},
+		{p: 100, want: 1000 * time.Microsecond},
+	}
+	for _, tt := range tests {
+		got, err := h.Percentile(tt.p)
+		if tt.err {
+			if err == nil {
+				t.Errorf("Percentile(%v) = %v, want an error", tt.p, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Percentile(%v) failed: %v", tt.p, err)
+			continue
+		}
+		if diff := math.Abs(float64(got-tt.want)) / float64(tt.want); diff > 0.01 {
+			t.Errorf("Percentile(%v) = %v, want %v within 1%%", tt.p, got, tt.want)
+		}
+	}
+	if p100, _ := h.Percentile(100); p100 != h.Max() {
+		t.Errorf("Percentile(100) = %v, want the max %v", p100, h.Max())
+	}
+}
+
+func TestPercentileWithinMinMax(t *testing.T) {
+	h := NewHistogram()
+	h.Record(1001 * time.Microsecond)
+	for _, p := range []float64{1, 50, 99.9, 100} {
+		if got, _ := h.Percentile(p); got != 1001*time.Microsecond {
+			t.Errorf("Percentile(%v) of a single value = %v, want 1.001ms", p, got)
+		}
+	}
+}
+
+func TestHistogramEmpty(t *testing.T) {
+	h := NewHistogram()
+	if h.Count() != 0 || h.Mean() != 0 || h.Min() != 0 || h.Max() != 0 {
+		t.Errorf("empty histogram has count %v, mean %v, min %v, max %v, want zeros", h.Count(), h.Mean(), h.Min(), h.Max())
+	}
+	for _, p := range []float64{50, 100} {
+		if got, err := h.Percentile(p); got != 0 || err != nil {
+			t.Errorf("Percentile(%v) of an empty histogram = %v, %v, want 0", p, got, err)
+		}
+	}
+}
+
+func TestHistogramClamp(t *testing.T) {
+	h := NewHistogram()
+	h.Record(-time.Second)
+	h.Record(2 * time.Hour)
+	if h.Min() != 0 {
+		t.Errorf("min = %v, want negative durations recorded as 0", h.Min())
+	}
+	if h.Max() != time.Hour {
+		t.Errorf("max = %v, want durations beyond an hour recorded as an hour", h.Max())
+	}
+}
+
+func TestHistogramMerge(t *testing.T) {
+	all := linearHistogram(1, 2000)
+	merged := linearHistogram(1, 500)
+	merged.Merge(linearHistogram(501, 2000))
+	merged.Merge(nil)
+
+	if merged.Count() != all.Count() || merged.Mean() != all.Mean() || merged.Min() != all.Min() || merged.Max() != all.Max() {
+		t.Errorf("merged count %v, mean %v, min %v, max %v, want %v, %v, %v, %v",
+			merged.Count(), merged.Mean(), merged.Min(), merged.Max(), all.Count(), all.Mean(), all.Min(), all.Max())
+	}
+	for _, p := range DefaultPercentiles {
+		got, _ := merged.Percentile(p)
+		want, _ := all.Percentile(p)
+		if got != want {
+			t.Errorf("merged Percentile(%v) = %v, want %v", p, got, want)
+		}
+	}
+
+	// merging into an empty histogram, as Clone does, keeps the other one intact
+	clone := all.Clone()
+	clone.Record(time.Hour)
+	if all.Max() == time.Hour || all.Count() == clone.Count() {
+		t.Error("recording into a clone changed the original")
+	}
+}
@@ -0,0 +1,176 @@
+package stats
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// Reporter is what runnables report the outcome of every execution to.
+type Reporter interface {
+	Report(reason string, elapsed time.Duration)
+	ReportFailure(reason string, msg string, elapsed time.Duration)
+	// ReportExecution reports an execution along with its details, e.g. phases.
+	ReportExecution(e Execution)
+	// WithTags returns a reporter which attaches tags to every execution, on top of tags of the reporter.
+	WithTags(tags Tags) Reporter
+	// Context is done once the stage stops running tasks, never unless set by WithContext.
+	Context() context.Context
+	// WithContext returns a reporter whose Context is ctx.
+	WithContext(ctx context.Context) Reporter
+}
+
+// Execution is a single report of a runnable.
+type Execution struct {
+	Time    time.Time // when the execution was reported, i.e. finished
+	Reason  string
+	Message string // failure message, empty for successes
+	Failed  bool
+	Elapsed time.Duration
+	Tags    Tags // shared between sinks, which must not modify them
+	tagsKey string
+	// Phases optionally break Elapsed down, e.g. dns, connect, tls, ttfb and transfer of an HTTP request
+	Phases []Phase
+	Reused bool // the execution reused a connection, e.g. a keep-alive one
+	// NewConnection is set when the execution opened the connection it used
+	NewConnection bool
+	// Streams shared the connection when the execution started, zero unless the protocol multiplexes
+	Streams int
+	// Protocol is the negotiated protocol, e.g. "HTTP/2.0 TLS 1.3 TLS_AES_128_GCM_SHA256", empty if unknown
+	Protocol string
+	// Events describe a streamed response, nil unless the runnable streams
+	Events *Events
+	// Sent and Received are sizes of the request and response, zero when the runnable doesn't measure them
+	Sent     Size
+	Received Size
+}
+
+// TagsKey identifies Tags like Tags.Key, rendered once by the Reporter.
+func (e Execution) TagsKey() string {
+	if e.tagsKey == "" && len(e.Tags) > 0 {
+		return e.Tags.Key()
+	}
+	return e.tagsKey
+}
+
+// measuresSize tells whether the runnable reported sizes of the execution.
+func (e Execution) measuresSize() bool {
+	return e.Sent != (Size{}) || e.Received != (Size{})
+}
+
+// Phase is a named part of an execution.
+type Phase struct {
+	Name    string
+	Elapsed time.Duration
+}
+
+// Sink consumes executions, Record is called concurrently from every worker.
+type Sink interface {
+	Record(e Execution)
+}
+
+// SinkFunc adapts a function to a Sink.
+type SinkFunc func(e Execution)
+
+func (f SinkFunc) Record(e Execution) {
+	f(e)
+}
+
+type fanOut struct {
+	sinks   []Sink
+	tags    Tags
+	tagsKey string // rendered once per reporter rather than by every sink for every execution
+	ctx     context.Context
+}
+
+// NewReporter creates a reporter which records every execution into each of sinks in order.
+func NewReporter(sinks ...Sink) Reporter {
+	return fanOut{sinks: sinks, ctx: context.Background()}
+}
+
+func (f fanOut) Report(reason string, elapsed time.Duration) {
+	f.record(Execution{Time: time.Now(), Reason: reason, Elapsed: elapsed, Tags: f.tags, tagsKey: f.tagsKey})
+}
+
+func (f fanOut) ReportFailure(reason string, msg string, elapsed time.Duration) {
+	f.record(Execution{Time: time.Now(), Reason: reason, Message: msg, Failed: true, Elapsed: elapsed, Tags: f.tags, tagsKey: f.tagsKey})
+}
+
+func (f fanOut) ReportExecution(e Execution) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	switch {
+	case len(e.Tags) == 0:
+		e.Tags, e.tagsKey = f.tags, f.tagsKey
+	case len(f.tags) > 0:
+		e.Tags = f.tags.With(e.Tags)
+		e.tagsKey = e.Tags.Key()
+	default:
+		e.tagsKey = e.Tags.Key()
+	}
+	f.record(e)
+}
+
+func (f fanOut) WithTags(tags Tags) Reporter {
+	merged := f.tags.With(tags)
+	return fanOut{sinks: f.sinks, tags: merged, tagsKey: merged.Key(), ctx: f.ctx}
+}
+
+func (f fanOut) Context() context.Context {
+	return f.ctx
+}
+
+func (f fanOut) WithContext(ctx context.Context) Reporter {
+	f.ctx = ctx
+	return f
+}
+
+func (f fanOut) record(e Execution) {
+	for _, s := range f.sinks {
+		s.Record(e)
+	}
+}
+
+// PhasedSink routes executions into warmup, measured or cooldown stats, nil stats disable the phase.
+type PhasedSink struct {
+	stats         *StageStats
+	warmup        *StageStats
+	warmupEnd     atomic.Int64 // unix nanos
+	cooldown      *StageStats
+	cooldownStart atomic.Int64 // unix nanos, zero until StartCooldown
+}
+
+func NewPhasedSink(stats, warmup, cooldown *StageStats, warmupEnd time.Time) *PhasedSink {
+	p := &PhasedSink{
+		stats:    stats,
+		warmup:   warmup,
+		cooldown: cooldown,
+	}
+	p.warmupEnd.Store(warmupEnd.UnixNano())
+	return p
+}
+
+// DelayWarmup moves the end of warmup by d, e.g. when the stage was paused during warmup.
+func (p *PhasedSink) DelayWarmup(d time.Duration) {
+	p.warmupEnd.Add(int64(d))
+}
+
+// StartCooldown marks the moment task submission stopped, everything reported afterward is a drain.
+func (p *PhasedSink) StartCooldown() {
+	p.cooldownStart.Store(time.Now().UnixNano())
+}
+
+func (p *PhasedSink) Record(e Execution) {
+	p.target(e).Record(e)
+}
+
+func (p *PhasedSink) target(e Execution) *StageStats {
+	if p.warmup != nil && e.Time.Add(-e.Elapsed).UnixNano() < p.warmupEnd.Load() {
+		return p.warmup
+	}
+	if cooldownStart := p.cooldownStart.Load(); p.cooldown != nil && cooldownStart != 0 && e.Time.UnixNano() > cooldownStart {
+		return p.cooldown
+	}
+	return p.stats
+}
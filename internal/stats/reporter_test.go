@@ -0,0 +1,75 @@
+package stats
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestPhasedSink(t *testing.T) {
+	measured, warmup, cooldown := NewStageStats(), NewStageStats(), NewStageStats()
+	now := time.Now()
+	p := NewPhasedSink(measured, warmup, cooldown, now)
+
+	// executions are routed by when they started, so one spanning the warmup end is a warmup one
+	p.Record(Execution{Time: now.Add(time.Millisecond), Elapsed: 2 * time.Millisecond})
+	p.Record(Execution{Time: now.Add(time.Second), Elapsed: time.Millisecond})
+	p.DelayWarmup(time.Minute)
+	p.Record(Execution{Time: now.Add(time.Second), Elapsed: time.Millisecond})
+	p.StartCooldown()
+	p.Record(Execution{Time: time.Now().Add(time.Hour), Elapsed: time.Millisecond})
+
+	for _, tt := range []struct {
+		name  string
+		stats *StageStats
+		want  int
+	}{
+		{"warmup", warmup, 2},
+		{"measured", measured, 1},
+		{"cooldown", cooldown, 1},
+	} {
+		if got := tt.stats.Executed(); got != tt.want {
+			t.Errorf("%v stats have %v executions, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPhasedSinkDisabledPhases(t *testing.T) {
+	measured := NewStageStats()
+	p := NewPhasedSink(measured, nil, nil, time.Now().Add(time.Hour))
+	p.StartCooldown()
+	p.Record(Execution{Time: time.Now(), Elapsed: time.Millisecond})
+	p.Record(Execution{Time: time.Now().Add(time.Hour), Elapsed: time.Millisecond})
+	if got := measured.Executed(); got != 2 {
+		t.Errorf("measured stats have %v executions, want 2", got)
+	}
+}
+
+func TestReporterExecution(t *testing.T) {
+	var got []Execution
+	reporter := NewReporter(SinkFunc(func(e Execution) { got = append(got, e) })).WithTags(Tags{"region": "eu"})
+	if reporter.Context().Done() != nil {
+		t.Error("context of a reporter can be done although none was set")
+	}
+
+	reporter.ReportExecution(Execution{Reason: "200", Tags: Tags{"step": "connect"}})
+	reporter.ReportExecution(Execution{Reason: "200"})
+	if len(got) != 2 {
+		t.Fatalf("recorded %v executions, want 2", len(got))
+	}
+	if got[0].Time.IsZero() {
+		t.Error("execution time wasn't set")
+	}
+	if want := (Tags{"region": "eu", "step": "connect"}); got[0].Tags.Key() != want.Key() || got[0].TagsKey() != want.Key() {
+		t.Errorf("tagged %v, want %v", got[0].Tags, want)
+	}
+	if want := (Tags{"region": "eu"}); got[1].TagsKey() != want.Key() {
+		t.Errorf("tagged %v, want %v", got[1].Tags, want)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if reporter.WithContext(ctx).WithTags(Tags{"a": "b"}).Context().Err() == nil {
+		t.Error("context set by WithContext was lost")
+	}
+}
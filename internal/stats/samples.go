@@ -0,0 +1,90 @@
+package stats
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// maxErrorSamples bounds distinct failure messages kept per series, the rest is only counted
+	maxErrorSamples = 10
+	// maxMessageLength truncates failure messages, e.g. whole response bodies
+	maxMessageLength = 256
+)
+
+// ErrorSample is a distinct failure message along with how often and when it occurred.
+type ErrorSample struct {
+	Message   string
+	Count     int
+	FirstSeen time.Time
+	LastSeen  time.Time
+}
+
+// errorSamples deduplicates failure messages, keeping at most maxErrorSamples of them.
+type errorSamples struct {
+	samples map[string]*ErrorSample
+	other   int // failures whose message didn't fit
+}
+
+func newErrorSamples() *errorSamples {
+	return &errorSamples{samples: make(map[string]*ErrorSample)}
+}
+
+func (s *errorSamples) record(msg string, at time.Time) {
+	if len(msg) > maxMessageLength {
+		msg = strings.ToValidUTF8(msg[:maxMessageLength], "") + "..."
+	}
+	sample, ok := s.samples[msg]
+	if !ok {
+		if len(s.samples) >= maxErrorSamples {
+			s.other++
+			return
+		}
+		sample = &ErrorSample{Message: msg, FirstSeen: at}
+		s.samples[msg] = sample
+	}
+	sample.Count++
+	sample.LastSeen = at
+}
+
+// merge adds samples of other, keeping the most frequent ones when there are too many.
+func (s *errorSamples) merge(samples []ErrorSample, other int) {
+	s.other += other
+	for _, o := range samples {
+		sample, ok := s.samples[o.Message]
+		if !ok {
+			sample = &ErrorSample{Message: o.Message, FirstSeen: o.FirstSeen}
+			s.samples[o.Message] = sample
+		}
+		sample.Count += o.Count
+		if o.FirstSeen.Before(sample.FirstSeen) {
+			sample.FirstSeen = o.FirstSeen
+		}
+		if o.LastSeen.After(sample.LastSeen) {
+			sample.LastSeen = o.LastSeen
+		}
+	}
+	if len(s.samples) <= maxErrorSamples {
+		return
+	}
+	for _, dropped := range s.sorted()[maxErrorSamples:] {
+		s.other += dropped.Count
+		delete(s.samples, dropped.Message)
+	}
+}
+
+// sorted copies samples, the most frequent first.
+func (s *errorSamples) sorted() []ErrorSample {
+	sorted := make([]ErrorSample, 0, len(s.samples))
+	for _, sample := range s.samples {
+		sorted = append(sorted, *sample)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Count != sorted[j].Count {
+			return sorted[i].Count > sorted[j].Count
+		}
+		return sorted[i].Message < sorted[j].Message
+	})
+	return sorted
+}
@@ -2,121 +2,613 @@ package stats
 
 import (
 	"fmt"
+	"runtime"
 	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
-type Reporter struct {
-	stats *StageStats
-	mx    *sync.Mutex
+// shardCount is a power of two, so picking a shard is masking a round-robin counter.
+var shardCount = nextPowerOfTwo(runtime.GOMAXPROCS(0) * 4)
+
+// StageStats records executions into independently locked shards, merged whenever the stats are read.
+type StageStats struct {
+	shards      []*shard
+	next        atomic.Uint64
+	start       atomic.Int64 // unix nanos of the first execution, aligns windows of all shards
+	window      time.Duration
+	annotations []Annotation
+	mx          *sync.Mutex // guards annotations
+}
+
+type shard struct {
+	executed int
+	metrics  reasonedExecMetrics
+	series   *timeSeries
+	mx       *sync.Mutex
+}
+
+func NewStageStats() *StageStats {
+	return NewWindowedStageStats(DefaultWindow)
+}
+
+// NewWindowedStageStats creates stats which on top of cumulative totals keep a time series with the given resolution.
+func NewWindowedStageStats(window time.Duration) *StageStats {
+	return newShardedStageStats(window, shardCount)
 }
 
-func NewReporter(stats *StageStats) Reporter {
-	return Reporter{
-		stats: stats,
-		mx:    &sync.Mutex{},
+func newShardedStageStats(window time.Duration, shardCount int) *StageStats {
+	shards := make([]*shard, shardCount)
+	for i := range shards {
+		shards[i] = &shard{
+			metrics: make(reasonedExecMetrics),
+			series:  newTimeSeries(window),
+			mx:      &sync.Mutex{},
+		}
+	}
+	return &StageStats{
+		shards: shards,
+		window: window,
+		mx:     &sync.Mutex{},
 	}
 }
 
-func (r *Reporter) Report(reason string, elapsed time.Duration) {
-	r.mx.Lock()
-	defer r.mx.Unlock()
+func (s *StageStats) Executed() int {
+	var executed int
+	for _, sh := range s.shards {
+		sh.mx.Lock()
+		executed += sh.executed
+		sh.mx.Unlock()
+	}
+	return executed
+}
+
+// Record makes StageStats a Sink, executions are kept in memory for summaries and exports.
+func (s *StageStats) Record(e Execution) {
+	start := s.seriesStart(e.Time)
+	sh := s.shards[s.next.Add(1)&uint64(len(s.shards)-1)]
 
-	r.stats.totalExecuted++
-	bucket := r.stats.metrics[reason]
+	sh.mx.Lock()
+	defer sh.mx.Unlock()
+
+	key := seriesKey(e.Reason, e.TagsKey())
+	sh.executed++
+	bucket := sh.metrics.bucket(key, e.Reason, e.Tags)
 	bucket.count++
-	bucket.elapsed = append(bucket.elapsed, float64(elapsed.Milliseconds()))
-	r.stats.metrics[reason] = bucket
+	if e.Failed {
+		bucket.errors++
+		bucket.samples.record(e.Message, e.Time)
+	}
+	bucket.latency.Record(e.Elapsed)
+	bucket.recordPhases(e)
+	bucket.recordTransfer(e)
+	sh.series.record(start, key, e)
+}
 
+// seriesStart returns the start of the time series, the first execution ever recorded sets it.
+func (s *StageStats) seriesStart(at time.Time) time.Time {
+	if start := s.start.Load(); start != 0 {
+		return time.Unix(0, start)
+	}
+	s.start.CompareAndSwap(0, at.UnixNano())
+	return time.Unix(0, s.start.Load())
 }
 
-func (r *Reporter) ReportFailure(reason string, msg string, elapsed time.Duration) {
-	r.mx.Lock()
-	defer r.mx.Unlock()
+// Annotate records msg at the current moment of the time series.
+func (s *StageStats) Annotate(msg string) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
 
-	r.stats.totalExecuted++
-	bucket := r.stats.metrics[reason]
-	bucket.count++
-	bucket.msg = append(bucket.msg, msg)
-	bucket.elapsed = append(bucket.elapsed, float64(elapsed.Milliseconds()))
-	r.stats.metrics[reason] = bucket
+	s.annotations = append(s.annotations, Annotation{Time: time.Now(), Message: msg})
 }
 
-type StageStats struct {
-	totalExecuted int
-	metrics       reasonedExecMetrics
-	mx            *sync.Mutex
+// Windows returns a copy of the time series recorded so far, the last window may still be in progress.
+func (s *StageStats) Windows() []Window {
+	return s.mergeWindows()
 }
 
-// todo refactor metrics gathering and reporting
-func (s *StageStats) Executed() int {
-	return s.totalExecuted
+// LastCompleteWindow returns the latest window no longer being recorded into, false if there's none.
+func (s *StageStats) LastCompleteWindow() (Window, bool) {
+	start := s.start.Load()
+	if start == 0 {
+		return Window{}, false
+	}
+	index := int(time.Since(time.Unix(0, start))/s.window) - 1
+	if index < 0 {
+		return Window{}, false
+	}
+
+	merged := newWindow(time.Unix(0, start).Add(time.Duration(index)*s.window), s.window)
+	for _, sh := range s.shards {
+		sh.mx.Lock()
+		if index < len(sh.series.windows) {
+			merged.merge(sh.series.windows[index])
+		}
+		sh.mx.Unlock()
+	}
+	return *merged, true
 }
 
-func NewStageStats() *StageStats {
-	return &StageStats{
-		metrics: make(reasonedExecMetrics),
-		mx:      &sync.Mutex{},
+func (s *StageStats) mergeWindows() []Window {
+	var merged []*Window
+	for _, sh := range s.shards {
+		sh.mx.Lock()
+		for i, w := range sh.series.windows {
+			if i == len(merged) {
+				merged = append(merged, newWindow(w.Start, w.Duration))
+			}
+			merged[i].merge(w)
+		}
+		sh.mx.Unlock()
+	}
+
+	windows := make([]Window, len(merged))
+	for i, w := range merged {
+		windows[i] = *w
+	}
+	return windows
+}
+
+// mergeMetrics sums executions and per series metrics of all shards into fresh buckets.
+func (s *StageStats) mergeMetrics() (int, reasonedExecMetrics) {
+	var executed int
+	merged := make(reasonedExecMetrics)
+	for _, sh := range s.shards {
+		sh.mx.Lock()
+		executed += sh.executed
+		for key, b := range sh.metrics {
+			merged.bucket(key, b.reason, b.tags).merge(b)
+		}
+		sh.mx.Unlock()
+	}
+	return executed, merged
+}
+
+// Snapshot is a copy of StageStats merged shard by shard, safe to read while the stage keeps running.
+type Snapshot struct {
+	Executed    int
+	Errors      int
+	Series      []SeriesSnapshot // sorted by reason and tags
+	Windows     []Window
+	Annotations []Annotation
+}
+
+// SeriesSnapshot holds metrics of executions sharing the reason and tags.
+type SeriesSnapshot struct {
+	Reason  string
+	Tags    Tags
+	Count   int
+	Errors  int
+	Latency *Histogram
+	// Samples are distinct failure messages, the most frequent first
+	Samples []ErrorSample
+	// OtherErrors counts failures beyond the bounded samples
+	OtherErrors int
+	// Phases hold latencies of execution phases in the order they were first reported, if the runnable reports any
+	Phases []PhaseSnapshot
+	// Reused counts executions which reused a connection
+	Reused int
+	// Protocols count executions per negotiated protocol, nil unless the runnable reports any
+	Protocols map[string]int
+	// Opened counts executions which opened a connection
+	Opened int
+	// Streams tell how many streams shared connections of multiplexed executions
+	Streams Streams
+	// Events is nil unless the runnable streams responses
+	Events *EventStats
+	// Sent and Received are nil unless the runnable reports sizes
+	Sent     *Transfer
+	Received *Transfer
+}
+
+// Streams summarize Execution.Streams of multiplexed executions.
+type Streams struct {
+	Executions int
+	Total      int
+	Max        int
+}
+
+// Mean is the average of streams sharing a connection, zero without multiplexed executions.
+func (s Streams) Mean() float64 {
+	if s.Executions == 0 {
+		return 0
+	}
+	return float64(s.Total) / float64(s.Executions)
+}
+
+func (s *Streams) merge(other Streams) {
+	s.Executions += other.Executions
+	s.Total += other.Total
+	s.Max = max(s.Max, other.Max)
+}
+
+type PhaseSnapshot struct {
+	Name    string
+	Latency *Histogram
+}
+
+func (s *StageStats) Snapshot() Snapshot {
+	snapshot := s.seriesSnapshot()
+	snapshot.Windows = s.mergeWindows()
+
+	s.mx.Lock()
+	snapshot.Annotations = append([]Annotation(nil), s.annotations...)
+	s.mx.Unlock()
+	return snapshot
+}
+
+// seriesSnapshot is a snapshot of cumulative metrics only, without the time series.
+func (s *StageStats) seriesSnapshot() Snapshot {
+	executed, metrics := s.mergeMetrics()
+	snapshot := Snapshot{Executed: executed}
+	for _, b := range metrics {
+		snapshot.Errors += b.errors
+		snapshot.Series = append(snapshot.Series, b.snapshot())
+	}
+	sortSeries(snapshot.Series)
+	return snapshot
+}
+
+// Filter narrows the snapshot down to series having every tag of filter, ReasonTag included.
+func (s Snapshot) Filter(filter Tags) Snapshot {
+	if len(filter) == 0 {
+		return s
+	}
+	filtered := Snapshot{Annotations: s.Annotations}
+	for _, series := range s.Series {
+		if matches(series.Reason, series.Tags, filter) {
+			filtered.Executed += series.Count
+			filtered.Errors += series.Errors
+			filtered.Series = append(filtered.Series, series)
+		}
+	}
+	for _, w := range s.Windows {
+		filtered.Windows = append(filtered.Windows, w.Filter(filter))
+	}
+	return filtered
+}
+
+// GroupBy merges series sharing values of the given tags, ReasonTag groups by reason.
+func (s Snapshot) GroupBy(groupBy ...string) []SeriesSnapshot {
+	groups := make(reasonedExecMetrics)
+	for _, series := range s.Series {
+		reason, tags := group(series.Reason, series.Tags, groupBy)
+		b := groups.bucket(seriesKey(reason, tags.Key()), reason, tags)
+		b.count += series.Count
+		b.errors += series.Errors
+		b.samples.merge(series.Samples, series.OtherErrors)
+		b.latency.Merge(series.Latency)
+		b.reused += series.Reused
+		b.opened += series.Opened
+		b.streams.merge(series.Streams)
+		b.mergeEvents(series.Events)
+		b.mergeProtocols(series.Protocols)
+		for _, p := range series.Phases {
+			b.phase(p.Name).Merge(p.Latency)
+		}
+		b.mergeTransfer(series.Sent, series.Received)
+	}
+
+	grouped := make([]SeriesSnapshot, 0, len(groups))
+	for _, b := range groups {
+		grouped = append(grouped, b.snapshot())
+	}
+	sortSeries(grouped)
+	return grouped
+}
+
+func sortSeries(series []SeriesSnapshot) {
+	sort.Slice(series, func(i, j int) bool {
+		if series[i].Reason != series[j].Reason {
+			return series[i].Reason < series[j].Reason
+		}
+		return series[i].Tags.String() < series[j].Tags.String()
+	})
+}
+
+// Latency merges latencies of all series.
+func (s Snapshot) Latency() *Histogram {
+	h := NewHistogram()
+	for _, series := range s.Series {
+		h.Merge(series.Latency)
+	}
+	return h
+}
+
+// Transfer merges sizes of all series, nil when no series measured them.
+func (s Snapshot) Transfer() (sent, received *Transfer) {
+	total := &reasonBucket{}
+	for _, series := range s.Series {
+		total.mergeTransfer(series.Sent, series.Received)
+	}
+	return total.sent, total.received
+}
+
+// ErrorRate is the share of failed executions, in range [0, 1].
+func (s Snapshot) ErrorRate() float64 {
+	if s.Executed == 0 {
+		return 0
+	}
+	return float64(s.Errors) / float64(s.Executed)
+}
+
+// Format renders counts and mean latency per reason, along with the given percentiles and max if any are requested.
+func (s *StageStats) Format(percentiles ...float64) string {
+	return s.FormatGrouped([]string{ReasonTag}, percentiles...)
+}
+
+// FormatGrouped renders counts and latencies per group of the given tags, ReasonTag groups by reason.
+func (s *StageStats) FormatGrouped(groupBy []string, percentiles ...float64) string {
+	snapshot := s.seriesSnapshot()
+	groups := snapshot.GroupBy(groupBy...)
+	if len(groups) == 0 {
+		return fmt.Sprintf("Total: %-18v |\nNo metrics", snapshot.Executed)
+	}
+
+	entries := make([]string, 0, len(groups))
+	for _, g := range groups {
+		b := reasonBucket{count: g.Count, latency: g.Latency}
+		entries = append(entries, fmt.Sprintf("%-25v | %-25v", g.label(), b.Format(percentiles)))
+		if len(g.Phases) > 0 {
+			entries = append(entries, fmt.Sprintf("%-25v | %v", "", g.formatPhases()))
+		}
+		if g.Events != nil {
+			entries = append(entries, fmt.Sprintf("%-25v | %v", "", g.Events.Format()))
+		}
+		if g.Sent != nil {
+			entries = append(entries, fmt.Sprintf("%-25v | sent: %v | received: %v", "", g.Sent.Format(), g.Received.Format()))
+		}
 	}
+	return fmt.Sprintf("Total: %-18v |\n%v", snapshot.Executed, strings.Join(entries, "\n"))
 }
 
-func (s *StageStats) Format(includePercentiles bool) string {
-	return fmt.Sprintf("Total: %-18v |\n%v", s.totalExecuted, s.metrics.format(includePercentiles))
+// FormatErrorSamples renders failure messages of every series, empty when nothing failed.
+func (s Snapshot) FormatErrorSamples() string {
+	var lines []string
+	for _, series := range s.Series {
+		for _, sample := range series.Samples {
+			lines = append(lines, fmt.Sprintf("%-25v | %6vx | %v - %v | %v", series.label(), sample.Count,
+				sample.FirstSeen.Format(sampleTimeFormat), sample.LastSeen.Format(sampleTimeFormat), sample.Message))
+		}
+		if series.OtherErrors > 0 {
+			lines = append(lines, fmt.Sprintf("%-25v | %6vx | other messages", series.label(), series.OtherErrors))
+		}
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+	return "Error samples:\n" + strings.Join(lines, "\n")
 }
 
-type reasonedExecMetrics map[string]reasonBucket
+const sampleTimeFormat = "15:04:05.000"
+
+// formatPhases renders mean latency of each phase along with connection usage and shares of negotiated protocols.
+func (s SeriesSnapshot) formatPhases() string {
+	parts := make([]string, 0, len(s.Phases)+1)
+	for _, p := range s.Phases {
+		parts = append(parts, fmt.Sprintf("%v: %v", p.Name, p.Latency.Mean()))
+	}
+	// runnables which don't track connections, e.g. grpc, report neither
+	if s.Reused+s.Opened > 0 {
+		parts = append(parts, fmt.Sprintf("reused: %.0f%%", float64(s.Reused)/float64(s.Count)*100))
+		parts = append(parts, fmt.Sprintf("opened: %v", s.Opened))
+	}
+	if s.Streams.Executions > 0 {
+		parts = append(parts, fmt.Sprintf("streams/conn: %.1f (max %v)", s.Streams.Mean(), s.Streams.Max))
+	}
+	protocols := make([]string, 0, len(s.Protocols))
+	for protocol := range s.Protocols {
+		protocols = append(protocols, protocol)
+	}
+	sort.Strings(protocols)
+	for _, protocol := range protocols {
+		parts = append(parts, fmt.Sprintf("%v: %.0f%%", protocol, float64(s.Protocols[protocol])/float64(s.Count)*100))
+	}
+	return strings.Join(parts, " | ")
+}
 
-func (m *reasonedExecMetrics) format(includePercentiles bool) string {
-	var entries []string
-	if len(*m) == 0 {
-		return "No metrics"
+// label names the series by its reason followed by its tags.
+func (s SeriesSnapshot) label() string {
+	parts := make([]string, 0, 2)
+	if s.Reason != "" {
+		parts = append(parts, s.Reason)
+	}
+	if len(s.Tags) > 0 {
+		parts = append(parts, s.Tags.String())
 	}
-	for k, v := range *m {
-		entries = append(entries, fmt.Sprintf("%-25v | %-25v", k, v.Format(includePercentiles)))
+	if len(parts) == 0 {
+		return "*"
 	}
+	return strings.Join(parts, " ")
+}
+
+// reasonedExecMetrics holds a bucket per series of reason and tags.
+type reasonedExecMetrics map[string]*reasonBucket
 
-	sort.Strings(entries)
-	return fmt.Sprintf("%v", strings.Join(entries, "\n"))
+func (m reasonedExecMetrics) bucket(key, reason string, tags Tags) *reasonBucket {
+	bucket, ok := m[key]
+	if !ok {
+		bucket = &reasonBucket{reason: reason, tags: tags, samples: newErrorSamples(), latency: NewHistogram()}
+		m[key] = bucket
+	}
+	return bucket
 }
 
 type reasonBucket struct {
-	count   int
-	msg     []string
-	elapsed []float64 // millis
+	reason     string
+	tags       Tags
+	count      int
+	errors     int
+	samples    *errorSamples
+	latency    *Histogram
+	phases     map[string]*Histogram
+	phaseOrder []string
+	reused     int
+	protocols  map[string]int
+	opened     int
+	streams    Streams
+	events     *EventStats
+	sent       *Transfer
+	received   *Transfer
+}
+
+// recordTransfer tracks sizes once the runnable reports any, executions before that don't count.
+func (b *reasonBucket) recordTransfer(e Execution) {
+	if b.sent == nil {
+		if !e.measuresSize() {
+			return
+		}
+		b.sent, b.received = newTransfer(), newTransfer()
+	}
+	b.sent.record(e.Sent)
+	b.received.record(e.Received)
+}
+
+func (b *reasonBucket) mergeTransfer(sent, received *Transfer) {
+	if sent == nil {
+		return
+	}
+	if b.sent == nil {
+		b.sent, b.received = newTransfer(), newTransfer()
+	}
+	b.sent.merge(sent)
+	b.received.merge(received)
 }
 
-func (b *reasonBucket) Format(includePercentiles bool) string {
-	if includePercentiles {
-		percentiles := ""
-		for k, v := range b.percentile(50, 90, 99) {
-			percentiles += fmt.Sprintf("[ %v: %v ]", k, v)
+// phase returns the histogram of the named phase, creating it on first use.
+func (b *reasonBucket) phase(name string) *Histogram {
+	h, ok := b.phases[name]
+	if !ok {
+		if b.phases == nil {
+			b.phases = make(map[string]*Histogram)
 		}
+		h = NewHistogram()
+		b.phases[name] = h
+		b.phaseOrder = append(b.phaseOrder, name)
+	}
+	return h
+}
 
-		return fmt.Sprintf("count: %-6v | mean: %-10v | percentiles: %v", b.count, b.avgDuration(), percentiles)
+func (b *reasonBucket) recordPhases(e Execution) {
+	if e.Reused {
+		b.reused++
+	}
+	if e.NewConnection {
+		b.opened++
+	}
+	if e.Streams > 0 {
+		b.streams.merge(Streams{Executions: 1, Total: e.Streams, Max: e.Streams})
 	}
-	return fmt.Sprintf("count: %-6v | mean: %-10v", b.count, b.avgDuration())
+	if e.Events != nil {
+		if b.events == nil {
+			b.events = newEventStats()
+		}
+		b.events.record(e.Events)
+	}
+	if e.Protocol != "" {
+		if b.protocols == nil {
+			b.protocols = make(map[string]int)
+		}
+		b.protocols[e.Protocol]++
+	}
+	for _, p := range e.Phases {
+		b.phase(p.Name).Record(p.Elapsed)
+	}
+}
 
+func (b *reasonBucket) snapshot() SeriesSnapshot {
+	return SeriesSnapshot{
+		Reason:      b.reason,
+		Tags:        b.tags,
+		Count:       b.count,
+		Errors:      b.errors,
+		Latency:     b.latency,
+		Samples:     b.samples.sorted(),
+		OtherErrors: b.samples.other,
+		Phases:      b.phaseSnapshots(),
+		Reused:      b.reused,
+		Protocols:   b.protocols,
+		Opened:      b.opened,
+		Streams:     b.streams,
+		Events:      b.events,
+		Sent:        b.sent,
+		Received:    b.received,
+	}
 }
 
-func (b *reasonBucket) avgDuration() time.Duration {
-	if len(b.elapsed) == 0 {
-		return time.Duration(0)
+func (b *reasonBucket) mergeEvents(events *EventStats) {
+	if events == nil {
+		return
 	}
-	return time.Duration(Avg(b.elapsed)) * time.Millisecond
+	if b.events == nil {
+		b.events = newEventStats()
+	}
+	b.events.merge(events)
 }
 
-func (b *reasonBucket) percentile(percentile ...float64) map[float64]time.Duration {
-	percentiles, err := Percentile(b.elapsed, percentile...)
-	if err != nil {
-		fmt.Printf("Cannot calcualte percentile: %v", err)
+func (b *reasonBucket) mergeProtocols(protocols map[string]int) {
+	for protocol, count := range protocols {
+		if b.protocols == nil {
+			b.protocols = make(map[string]int)
+		}
+		b.protocols[protocol] += count
+	}
+}
+
+func (b *reasonBucket) phaseSnapshots() []PhaseSnapshot {
+	if len(b.phaseOrder) == 0 {
 		return nil
 	}
+	phases := make([]PhaseSnapshot, 0, len(b.phaseOrder))
+	for _, name := range b.phaseOrder {
+		phases = append(phases, PhaseSnapshot{Name: name, Latency: b.phases[name]})
+	}
+	return phases
+}
+
+func (b *reasonBucket) merge(other *reasonBucket) {
+	b.count += other.count
+	b.errors += other.errors
+	b.samples.merge(other.samples.sorted(), other.samples.other)
+	b.latency.Merge(other.latency)
+	b.reused += other.reused
+	b.opened += other.opened
+	b.streams.merge(other.streams)
+	b.mergeEvents(other.events)
+	b.mergeProtocols(other.protocols)
+	for _, name := range other.phaseOrder {
+		b.phase(name).Merge(other.phases[name])
+	}
+	b.mergeTransfer(other.sent, other.received)
+}
+
+func (b *reasonBucket) Format(percentiles []float64) string {
+	if len(percentiles) > 0 {
+		return fmt.Sprintf("count: %-6v | mean: %-10v | %v", b.count, b.latency.Mean(), b.formatPercentiles(percentiles))
+	}
+	return fmt.Sprintf("count: %-6v | mean: %-10v", b.count, b.latency.Mean())
+}
+
+func (b *reasonBucket) formatPercentiles(percentiles []float64) string {
+	values, err := b.latency.Percentiles(percentiles...)
+	if err != nil {
+		return fmt.Sprintf("cannot calculate percentiles: %v", err)
+	}
+
+	var formatted []string
+	for i, p := range percentiles {
+		formatted = append(formatted, fmt.Sprintf("p%v: %v", p, values[i].Round(10*time.Microsecond)))
+	}
+	formatted = append(formatted, fmt.Sprintf("max: %v", b.latency.Max().Round(10*time.Microsecond)))
+	return strings.Join(formatted, " ")
+}
 
-	m := make(map[float64]time.Duration)
-	for i, p := range percentile {
-		m[p] = time.Duration(percentiles[i]) * time.Millisecond
+func nextPowerOfTwo(n int) int {
+	p := 1
+	for p < n {
+		p <<= 1
 	}
-	return m
+	return p
 }
@@ -0,0 +1,137 @@
+package stats
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+var benchReasons = []string{"200", "201", "404", "500"}
+
+// BenchmarkRecord compares sharded stats against a single shard, i.e. a single lock around the whole stats as
+// recording was designed before, both with and without a reader snapshotting the stats like the console and
+// dashboard do. Run it with go test -run '^$' -bench Record -cpu 1,4,16 ./internal/stats
+func BenchmarkRecord(b *testing.B) {
+	for _, bench := range []struct {
+		name   string
+		shards int
+	}{
+		{"sharded", shardCount},
+		{"single lock", 1},
+	} {
+		for _, reading := range []bool{false, true} {
+			name := bench.name
+			if reading {
+				name += " with reader"
+			}
+			b.Run(name, func(b *testing.B) {
+				st := newShardedStageStats(DefaultWindow, bench.shards)
+				reporter := NewReporter(st)
+				if reading {
+					done := readContinuously(st)
+					defer done()
+				}
+				b.ReportAllocs()
+				b.RunParallel(func(pb *testing.PB) {
+					var i int
+					for pb.Next() {
+						reporter.Report(benchReasons[i%len(benchReasons)], time.Duration(i%5000)*time.Microsecond)
+						i++
+					}
+				})
+			})
+		}
+	}
+}
+
+// readContinuously snapshots and formats st until the returned func is called.
+func readContinuously(st *StageStats) func() {
+	stop, stopped := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(stopped)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				_ = st.Snapshot()
+				_ = st.FormatGrouped([]string{ReasonTag}, DefaultPercentiles...)
+				_, _ = st.LastCompleteWindow()
+			}
+		}
+	}()
+	return func() {
+		close(stop)
+		<-stopped
+	}
+}
+
+func TestStageStatsConcurrentRecordAndSnapshot(t *testing.T) {
+	const (
+		workers   = 8
+		perWorker = 2000
+	)
+	st := NewWindowedStageStats(5 * time.Millisecond)
+	reporter := NewReporter(st)
+	done := readContinuously(st)
+
+	wg := &sync.WaitGroup{}
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func(w int) {
+			defer wg.Done()
+			tagged := reporter.WithTags(Tags{"worker": string(rune('a' + w))})
+			for i := 0; i < perWorker; i++ {
+				if i%10 == 0 {
+					tagged.ReportFailure("500", "boom", time.Millisecond)
+					continue
+				}
+				tagged.Report("200", time.Duration(i)*time.Microsecond)
+			}
+		}(w)
+	}
+	wg.Wait()
+	done()
+
+	snapshot := st.Snapshot()
+	if snapshot.Executed != workers*perWorker {
+		t.Fatalf("executed %v, want %v", snapshot.Executed, workers*perWorker)
+	}
+	if snapshot.Errors != workers*perWorker/10 {
+		t.Errorf("errors %v, want %v", snapshot.Errors, workers*perWorker/10)
+	}
+	var inSeries, inWindows int
+	for _, series := range snapshot.Series {
+		inSeries += series.Count
+	}
+	for _, w := range snapshot.Windows {
+		inWindows += w.Total().Count
+	}
+	if inSeries != snapshot.Executed || inWindows != snapshot.Executed {
+		t.Errorf("series count %v and windows count %v, want %v", inSeries, inWindows, snapshot.Executed)
+	}
+}
+
+func TestLastCompleteWindow(t *testing.T) {
+	st := NewWindowedStageStats(time.Minute)
+	if _, ok := st.LastCompleteWindow(); ok {
+		t.Fatal("window without executions")
+	}
+
+	start := time.Now().Add(-150 * time.Second)
+	for _, at := range []time.Duration{0, 90 * time.Second, 100 * time.Second, 130 * time.Second} {
+		st.Record(Execution{Time: start.Add(at), Reason: "200", Elapsed: time.Millisecond})
+	}
+	st.Record(Execution{Time: start.Add(95 * time.Second), Reason: "500", Failed: true, Message: "boom"})
+
+	w, ok := st.LastCompleteWindow()
+	if !ok {
+		t.Fatal("no complete window")
+	}
+	if !w.Start.Equal(start.Add(time.Minute)) {
+		t.Errorf("window starts at %v, want %v", w.Start, start.Add(time.Minute))
+	}
+	if total := w.Total(); total.Count != 3 || total.Errors != 1 {
+		t.Errorf("window has %v executions and %v errors, want 3 and 1", total.Count, total.Errors)
+	}
+}
@@ -0,0 +1,110 @@
+package stats
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ReasonTag names the reason when grouping or filtering, so reasons are treated like any other tag.
+const ReasonTag = "reason"
+
+// Tags are arbitrary dimensions of an execution on top of its reason, e.g. endpoint, method, step or region.
+type Tags map[string]string
+
+// ParseTags parses a comma separated list of name=value pairs, e.g. "endpoint=/search,region=eu".
+func ParseTags(s string) (Tags, error) {
+	tags := make(Tags)
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(pair, "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid tag [%v], expected name=value", pair)
+		}
+		tags[name] = value
+	}
+	return tags, nil
+}
+
+// String renders tags sorted by name, e.g. "endpoint=/search,region=eu".
+func (t Tags) String() string {
+	pairs := make([]string, 0, len(t))
+	for _, name := range t.Names() {
+		pairs = append(pairs, name+"="+t[name])
+	}
+	return strings.Join(pairs, ",")
+}
+
+// Names returns tag names in sorted order.
+func (t Tags) Names() []string {
+	names := make([]string, 0, len(t))
+	for name := range t {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// With returns a copy of t extended by other, other wins on conflicts.
+func (t Tags) With(other Tags) Tags {
+	merged := make(Tags, len(t)+len(other))
+	for k, v := range t {
+		merged[k] = v
+	}
+	for k, v := range other {
+		merged[k] = v
+	}
+	return merged
+}
+
+// Key identifies the tags, unlike String separators can't clash with printable values.
+func (t Tags) Key() string {
+	var b strings.Builder
+	for _, name := range t.Names() {
+		b.WriteByte('\x1f')
+		b.WriteString(name)
+		b.WriteByte('\x1e')
+		b.WriteString(t[name])
+	}
+	return b.String()
+}
+
+// seriesKey identifies executions sharing the reason and tags, tagsKey is rendered by Tags.Key.
+func seriesKey(reason, tagsKey string) string {
+	return reason + tagsKey
+}
+
+// matches tells whether an execution of the reason and tags has every tag of filter, ReasonTag included.
+func matches(reason string, tags Tags, filter Tags) bool {
+	for name, value := range filter {
+		if name == ReasonTag {
+			if reason != value {
+				return false
+			}
+			continue
+		}
+		if v, ok := tags[name]; !ok || v != value {
+			return false
+		}
+	}
+	return true
+}
+
+// group narrows the reason and tags down to the dimensions of groupBy, ReasonTag keeps the reason.
+func group(reason string, tags Tags, groupBy []string) (string, Tags) {
+	var groupReason string
+	grouped := make(Tags)
+	for _, name := range groupBy {
+		if name == ReasonTag {
+			groupReason = reason
+			continue
+		}
+		if v, ok := tags[name]; ok {
+			grouped[name] = v
+		}
+	}
+	return groupReason, grouped
+}
@@ -0,0 +1,157 @@
+package stats
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DefaultWindow is the time series resolution used unless a stage configures its own.
+const DefaultWindow = time.Second
+
+// Window holds metrics of executions finished within [Start, Start+Duration).
+type Window struct {
+	Start    time.Time
+	Duration time.Duration
+	// Series holds metrics per reason and tags combination
+	Series map[string]*WindowMetrics
+}
+
+type WindowMetrics struct {
+	Reason  string
+	Tags    Tags
+	Count   int
+	Errors  int
+	Latency *Histogram
+	// Sent and Received are wire bytes of the executions
+	Sent     int64
+	Received int64
+}
+
+func newWindow(start time.Time, duration time.Duration) *Window {
+	return &Window{
+		Start:    start,
+		Duration: duration,
+		Series:   make(map[string]*WindowMetrics),
+	}
+}
+
+func (w *Window) series(key, reason string, tags Tags) *WindowMetrics {
+	m, ok := w.Series[key]
+	if !ok {
+		m = &WindowMetrics{Reason: reason, Tags: tags, Latency: NewHistogram()}
+		w.Series[key] = m
+	}
+	return m
+}
+
+func (w *Window) record(key string, e Execution) {
+	m := w.series(key, e.Reason, e.Tags)
+	m.Count++
+	if e.Failed {
+		m.Errors++
+	}
+	m.Latency.Record(e.Elapsed)
+	m.Sent += e.Sent.Wire()
+	m.Received += e.Received.Wire()
+}
+
+// Filter returns the window narrowed down to series having every tag of filter, ReasonTag included.
+func (w Window) Filter(filter Tags) Window {
+	filtered := *newWindow(w.Start, w.Duration)
+	for key, m := range w.Series {
+		if matches(m.Reason, m.Tags, filter) {
+			filtered.Series[key] = m
+		}
+	}
+	return filtered
+}
+
+// Total merges metrics of all series.
+func (w *Window) Total() *WindowMetrics {
+	total := &WindowMetrics{Latency: NewHistogram()}
+	for _, m := range w.Series {
+		total.Count += m.Count
+		total.Errors += m.Errors
+		total.Latency.Merge(m.Latency)
+		total.Sent += m.Sent
+		total.Received += m.Received
+	}
+	return total
+}
+
+// Throughput is the achieved amount of executions per second within the window.
+func (w *Window) Throughput() float64 {
+	return w.Total().Throughput(w.Duration)
+}
+
+func (m *WindowMetrics) Throughput(window time.Duration) float64 {
+	return float64(m.Count) / window.Seconds()
+}
+
+// Bandwidth is the amount of bytes sent and received per second within the window.
+func (m *WindowMetrics) Bandwidth(window time.Duration) (sent, received float64) {
+	return float64(m.Sent) / window.Seconds(), float64(m.Received) / window.Seconds()
+}
+
+// Format renders a one line summary of the window across all series.
+func (w *Window) Format(percentiles ...float64) string {
+	total := w.Total()
+	parts := []string{
+		fmt.Sprintf("throughput: %.1f/s", total.Throughput(w.Duration)),
+		fmt.Sprintf("errors: %v", total.Errors),
+	}
+	if total.Sent > 0 || total.Received > 0 {
+		sent, received := total.Bandwidth(w.Duration)
+		parts = append(parts, fmt.Sprintf("out: %v/s", FormatBytes(int64(sent))), fmt.Sprintf("in: %v/s", FormatBytes(int64(received))))
+	}
+	values, err := total.Latency.Percentiles(percentiles...)
+	if err != nil {
+		return fmt.Sprintf("cannot calculate percentiles: %v", err)
+	}
+	for i, p := range percentiles {
+		parts = append(parts, fmt.Sprintf("p%v: %v", p, values[i].Round(10*time.Microsecond)))
+	}
+	return strings.Join(parts, " | ")
+}
+
+// merge adds metrics of other, which covers the same period, into w.
+func (w *Window) merge(other *Window) {
+	for key, m := range other.Series {
+		merged := w.series(key, m.Reason, m.Tags)
+		merged.Count += m.Count
+		merged.Errors += m.Errors
+		merged.Latency.Merge(m.Latency)
+		merged.Sent += m.Sent
+		merged.Received += m.Received
+	}
+}
+
+// Annotation marks a moment of the time series, e.g. a manual load adjustment.
+type Annotation struct {
+	Time    time.Time
+	Message string
+}
+
+// timeSeries splits executions into fixed windows aligned to a start shared by all shards.
+type timeSeries struct {
+	window  time.Duration
+	windows []*Window
+}
+
+func newTimeSeries(window time.Duration) *timeSeries {
+	return &timeSeries{
+		window: window,
+	}
+}
+
+func (t *timeSeries) record(start time.Time, key string, e Execution) {
+	index := int(e.Time.Sub(start) / t.window)
+	if index < 0 {
+		index = 0
+	}
+	for len(t.windows) <= index {
+		t.windows = append(t.windows, newWindow(start.Add(time.Duration(len(t.windows))*t.window), t.window))
+	}
+	t.windows[index].record(key, e)
+}
@@ -105,22 +105,22 @@ func ClearConsole() {
 	}
 }
 
-func GetPubsubTopic(logger ltlogger.Logger, client *pubsub.Client, topic string) *pubsub.Topic {
+func GetPubsubTopic(logger ltlogger.Logger, client *pubsub.Client, topic string) (*pubsub.Topic, error) {
 	t := client.Topic(topic)
 	exists, err := t.Exists(context.Background())
 	if err != nil {
-		logger.Fatal("Failed to check if topic exists", "topic", topic, "err", err)
+		return nil, fmt.Errorf("check if topic [%v] exists: %w", topic, err)
 	}
 	if !exists {
 		_, err := client.CreateTopic(context.Background(), topic)
 		if err != nil {
-			logger.Fatal("Failed to create topic", "topic", topic, "err", err)
+			return nil, fmt.Errorf("create topic [%v]: %w", topic, err)
 		}
 		logger.Info("Topic created", "topic", topic)
 	}
 	logger.Info("Got topic", "topic", topic)
 
-	return t
+	return t, nil
 }
 
 func GetPubsubSubscription(logger ltlogger.Logger, client *pubsub.Client, topic *pubsub.Topic, subscription string) *pubsub.Subscription {
@@ -4,14 +4,67 @@ import (
 	"aggressive-pokes/internal/stats"
 	"context"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 const MaxWorkerPool = 10000
 
-var tasks chan func(reporter stats.Reporter)
+// task is a submitted runnable along with the moment it was submitted, to measure how long it waited for a worker.
+type task struct {
+	run         func(reporter stats.Reporter)
+	submittedAt time.Time
+}
+
+var tasks chan task
+
+var (
+	poolSize  atomic.Int64
+	busy      atomic.Int64
+	queued    atomic.Int64
+	lagTotal  atomic.Int64
+	lagMax    atomic.Int64
+	lagCount  atomic.Uint64
+	completed atomic.Uint64
+)
+
+// PoolStats describes the worker pool, lag is the time tasks spent queued before a worker picked them up.
+type PoolStats struct {
+	Size      int
+	Busy      int
+	Queued    int
+	Completed uint64
+	LagTotal  time.Duration
+	LagMax    time.Duration
+	LagCount  uint64
+}
+
+// Stats returns the state of the current pool, lag and completed counters accumulate across pools.
+func Stats() PoolStats {
+	return PoolStats{
+		Size:      int(poolSize.Load()),
+		Busy:      int(busy.Load()),
+		Queued:    int(queued.Load()),
+		Completed: completed.Load(),
+		LagTotal:  time.Duration(lagTotal.Load()),
+		LagMax:    time.Duration(lagMax.Load()),
+		LagCount:  lagCount.Load(),
+	}
+}
 
-func Submit(task func(reporter stats.Reporter)) {
-	tasks <- task
+// Submit queues the runnable, waiting for room in the queue unless ctx is done first, which it tells by returning false.
+func Submit(ctx context.Context, runnable func(reporter stats.Reporter)) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	queued.Add(1)
+	select {
+	case tasks <- task{run: runnable, submittedAt: time.Now()}:
+		return true
+	case <-ctx.Done():
+		queued.Add(-1)
+		return false
+	}
 }
 
 func Cancel() {
@@ -22,7 +75,9 @@ func StartWorkers(ctx context.Context, reporter stats.Reporter, n int) chan stru
 	if float64(n) > MaxWorkerPool {
 		n = MaxWorkerPool
 	}
-	tasks = make(chan func(reporter stats.Reporter), MaxWorkerPool)
+	tasks = make(chan task, MaxWorkerPool)
+	queued.Store(0)
+	poolSize.Store(int64(n))
 
 	wg := &sync.WaitGroup{}
 	wg.Add(n)
@@ -36,20 +91,39 @@ func StartWorkers(ctx context.Context, reporter stats.Reporter, n int) chan stru
 						wg.Done()
 						//fmt.Printf("Worker %v done\n", w)
 						return
-					case runnable, ok := <-tasks:
+					case t, ok := <-tasks:
 						if !ok {
 							wg.Done()
 							//fmt.Printf("Worker %v: Channel closed\n", w)
 							return
 						}
-						runnable(reporter)
+						execute(t, reporter)
 					}
 				}
 			}(w)
 		}
 		wg.Wait()
+		poolSize.Store(0)
 		poolFinished <- struct{}{}
 		close(poolFinished)
 	}()
 	return poolFinished
 }
+
+func execute(t task, reporter stats.Reporter) {
+	queued.Add(-1)
+	lag := int64(time.Since(t.submittedAt))
+	lagTotal.Add(lag)
+	lagCount.Add(1)
+	for {
+		max := lagMax.Load()
+		if lag <= max || lagMax.CompareAndSwap(max, lag) {
+			break
+		}
+	}
+
+	busy.Add(1)
+	defer busy.Add(-1)
+	defer completed.Add(1)
+	t.run(reporter)
+}
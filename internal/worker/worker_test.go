@@ -0,0 +1,40 @@
+package worker
+
+import (
+	"aggressive-pokes/internal/stats"
+	"context"
+	"testing"
+	"time"
+)
+
+func TestSubmitCanceled(t *testing.T) {
+	stopped, stop := context.WithCancel(context.Background())
+	stop()
+	<-StartWorkers(stopped, nil, 1)
+
+	// with no workers left the queue fills up, Submit gives up once ctx is done rather than block
+	ctx, cancel := context.WithCancel(context.Background())
+	submitted := make(chan int)
+	go func() {
+		n := 0
+		for Submit(ctx, func(stats.Reporter) {}) {
+			n++
+		}
+		submitted <- n
+	}()
+	time.AfterFunc(20*time.Millisecond, cancel)
+	select {
+	case n := <-submitted:
+		if n != MaxWorkerPool {
+			t.Errorf("submitted %v tasks, want %v", n, MaxWorkerPool)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Submit blocked once canceled")
+	}
+	if q := Stats().Queued; q != MaxWorkerPool {
+		t.Errorf("%v tasks queued, want %v", q, MaxWorkerPool)
+	}
+	if Submit(ctx, func(stats.Reporter) {}) {
+		t.Error("submitted a task once canceled")
+	}
+}